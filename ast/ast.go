@@ -4,7 +4,6 @@ package ast
 import (
 	"fmt"
 	"sort"
-	"strconv"
 	"strings"
 )
 
@@ -50,6 +49,9 @@ type Node struct {
 	// Whether or not all children are in the same line.
 	// (eg "base { id: "id" }")
 	ChildrenSameLine bool
+	// The "," or ";" after the field in the input, if any (e.g. "base { id: 1, name: "n" }").
+	// Only printed in messages written on one line, see config.Config.Separators.
+	Separator string
 	// Comment in the same line as the "}".
 	ClosingBraceComment string
 	// End holds the position suitable for inserting new items.
@@ -57,6 +59,14 @@ type Node struct {
 	// For single-line nodes, this is the first character after the last item (usually a space).
 	// For non-message nodes, this is Position zero value.
 	End Position
+	// FieldStart is the position of the first character of the field, after its comments: the
+	// field name, or the opening brace of an unnamed message.
+	FieldStart Position
+	// FieldEnd is the position right after the last character of the field, excluding separators
+	// and trailing comments: the last value, or the closing bracket of a message or list.
+	// For comment-only nodes, FieldStart and FieldEnd are both the position after the comments,
+	// so that Start and FieldEnd delimit the source of any node.
+	FieldEnd Position
 	// Keep values in list (e.g "list: [1, 2]").
 	ValuesAsList bool
 	// Keep children in list (e.g "list: [ { value: 1 }, { value: 2 } ]").
@@ -69,11 +79,20 @@ type Node struct {
 	//   # Comment
 	// ]
 	PostValuesComments []string
+	// CommentStarts holds the positions of the first characters of the comments of the node as
+	// parsed: of the non-empty lines of PreComments, PostValuesComments and ClosingBraceComment, in
+	// this order. A zero position is unknown, e.g. that of a comment added by edits. They're only
+	// used while there is one for each of these lines, so edits of the comments that don't update
+	// them leave the positions unknown.
+	CommentStarts []Position
 	// Whether the braces used for the children of this node are curly braces or angle brackets.
 	IsAngleBracket bool
 	// If this is not empty, it means that formatting was disabled for this node and it contains the
 	// raw, unformatted node string.
 	Raw string
+	// If this is not empty, the input of this node could not be parsed and this describes the syntax
+	// error. Raw contains the skipped input. Only set when parsing with error recovery.
+	SyntaxError string
 	// Used when we want to break between the field name and values when a
 	// single-line node exceeds the requested wrap column.
 	PutSingleValueOnNextLine bool
@@ -342,9 +361,40 @@ func (n *Node) fix() fixData {
 	return d
 }
 
+// Clone returns a deep copy of the node, including its comments, values and children.
+func (n *Node) Clone() *Node {
+	c := *n
+	c.PreComments = cloneStrings(n.PreComments)
+	c.PostValuesComments = cloneStrings(n.PostValuesComments)
+	c.CommentStarts = clonePositions(n.CommentStarts)
+	if n.Values != nil {
+		c.Values = make([]*Value, len(n.Values))
+		for i, v := range n.Values {
+			c.Values[i] = v.Clone()
+		}
+	}
+	if n.Children != nil { // Also for 0 children.
+		c.Children = make([]*Node, len(n.Children))
+		for i, child := range n.Children {
+			c.Children[i] = child.Clone()
+		}
+	}
+	return &c
+}
+
+// cloneStrings copies s, keeping nil and empty slices apart.
+func cloneStrings(s []string) []string {
+	return append(s[:0:0], s...)
+}
+
+// clonePositions copies s, keeping nil and empty slices apart.
+func clonePositions(s []Position) []Position {
+	return append(s[:0:0], s...)
+}
+
 // StringNode is a helper for constructing simple string nodes.
 func StringNode(name, unquoted string) *Node {
-	return &Node{Name: name, Values: []*Value{{Value: strconv.Quote(unquoted)}}}
+	return &Node{Name: name, Values: []*Value{StringValue(unquoted)}}
 }
 
 // Value represents a field value in a proto message.
@@ -356,6 +406,21 @@ type Value struct {
 	Value string
 	// Comment in the same line as the value.
 	InlineComment string
+	// Start is the position of the first character of the value, e.g. its opening quote.
+	Start Position
+	// End is the position right after the last character of the value, before any comment.
+	End Position
+	// CommentStarts holds the positions of the first characters of the non-empty lines of
+	// PreComments and InlineComment as parsed, like Node.CommentStarts.
+	CommentStarts []Position
+}
+
+// Clone returns a copy of the value, including its comments.
+func (v *Value) Clone() *Value {
+	c := *v
+	c.PreComments = cloneStrings(v.PreComments)
+	c.CommentStarts = clonePositions(v.CommentStarts)
+	return &c
 }
 
 func (v *Value) String() string {
@@ -452,7 +452,7 @@ func TestListSyntax(t *testing.T) {
 					Name:      "",
 					SkipColon: true,
 					Children: []*ast.Node{
-						&ast.Node{Name: "field", Values: []*ast.Value{&ast.Value{Value: "val1"}}},
+						&ast.Node{Name: "field", Values: []*ast.Value{&ast.Value{Value: "val1"}}, Separator: ","},
 						&ast.Node{Name: "other_field", Values: []*ast.Value{&ast.Value{Value: "val2"}}},
 					},
 				},
@@ -460,7 +460,7 @@ func TestListSyntax(t *testing.T) {
 					Name:      "",
 					SkipColon: true,
 					Children: []*ast.Node{
-						&ast.Node{Name: "field", Values: []*ast.Value{&ast.Value{Value: "val3"}}},
+						&ast.Node{Name: "field", Values: []*ast.Value{&ast.Value{Value: "val3"}}, Separator: ","},
 					},
 				},
 			}}},
@@ -476,7 +476,7 @@ func TestListSyntax(t *testing.T) {
 			&ast.Node{
 				Name: "foo",
 				Children: []*ast.Node{
-					&ast.Node{Name: "field", Values: []*ast.Value{&ast.Value{Value: "val1"}}},
+					&ast.Node{Name: "field", Values: []*ast.Value{&ast.Value{Value: "val1"}}, Separator: ","},
 					&ast.Node{Name: "other_field", Values: []*ast.Value{&ast.Value{Value: "val2"}}},
 				},
 			},
@@ -484,8 +484,9 @@ func TestListSyntax(t *testing.T) {
 				Name: "foo",
 				Children: []*ast.Node{
 					&ast.Node{
-						Name:   "field",
-						Values: []*ast.Value{&ast.Value{Value: "val3"}},
+						Name:      "field",
+						Values:    []*ast.Value{&ast.Value{Value: "val3"}},
+						Separator: ",",
 					},
 				},
 			}},
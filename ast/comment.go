@@ -0,0 +1,321 @@
+package ast
+
+import "strings"
+
+// CommentKind describes where a comment is placed relative to what it comments.
+type CommentKind int
+
+const (
+	// LeadingComment is on the lines right before a field, or before a value of a list.
+	LeadingComment CommentKind = iota
+	// TrailingComment is at the end of the line of a value, or of the closing bracket of a message
+	// or list.
+	TrailingComment
+	// DetachedComment is separated from the next field by a blank line. The comments of comment-only
+	// nodes are detached.
+	DetachedComment
+	// ClosingComment is on the lines before the closing bracket of a message or list, after its last
+	// field or value. In messages, these are the comments of a comment-only last child.
+	ClosingComment
+)
+
+// String returns the name of the kind, e.g. "leading".
+func (k CommentKind) String() string {
+	switch k {
+	case LeadingComment:
+		return "leading"
+	case TrailingComment:
+		return "trailing"
+	case DetachedComment:
+		return "detached"
+	case ClosingComment:
+		return "closing"
+	}
+	return "unknown"
+}
+
+// Comment is a comment of a node, as returned by Node.Comments. Comments are stored in the node as
+// lines in PreComments, Value.PreComments, Value.InlineComment, PostValuesComments and
+// ClosingBraceComment; Comment gives a typed view of them.
+type Comment struct {
+	Kind CommentKind
+	// Text of the comment, without the # and the space after it.
+	Text string
+	// Whether the comment is separated from the previous comment by a blank line. A blank line
+	// before the first comment of a node belongs to the node and is kept by SetComments.
+	BlankLineBefore bool
+	// Value is the value the comment is attached to, for leading and trailing comments of values.
+	// It's nil for comments of the node itself.
+	Value *Value
+	// Start is the position of the # of the comment in the parsed input, and End the position right
+	// after its last character. Both are zero if they aren't known, e.g. for comments added by
+	// edits.
+	Start, End Position
+	// line is the comment as written in the input, kept as long as Text is unchanged.
+	line string
+}
+
+// commentText returns the text of a comment line.
+func commentText(line string) string {
+	if !strings.HasPrefix(line, "#") {
+		return line // A template.
+	}
+	return strings.TrimPrefix(line[1:], " ")
+}
+
+// String returns the comment as written in the file, e.g. "# Text".
+func (c Comment) String() string {
+	if c.line != "" && commentText(c.line) == c.Text {
+		return c.line
+	}
+	if c.Text == "" {
+		return "#"
+	}
+	return "# " + c.Text
+}
+
+// Comments returns the comments of n, in the order in which they're printed. Comments of children
+// are not included, except for the closing comments of messages.
+func (n *Node) Comments() []Comment {
+	var res []Comment
+	// addLines adds the comments of lines, whose non-empty lines start at starts, if known.
+	addLines := func(kind CommentKind, v *Value, lines []string, starts []Position) {
+		blank := false
+		for _, l := range lines {
+			if l == "" {
+				blank = len(res) > 0
+				continue
+			}
+			c := Comment{Kind: kind, Text: commentText(l), BlankLineBefore: blank, Value: v, line: l}
+			if len(starts) > 0 {
+				if starts[0].Line > 0 {
+					c.Start, c.End = starts[0], starts[0].after(l)
+				}
+				starts = starts[1:]
+			}
+			res = append(res, c)
+			blank = false
+		}
+	}
+	starts := splitStarts(n.CommentStarts, n.PreComments, n.PostValuesComments, []string{n.ClosingBraceComment})
+	if n.IsCommentOnly() {
+		addLines(DetachedComment, nil, n.PreComments, starts[0])
+		return res
+	}
+	// Only the comments after the last blank line are attached to the field.
+	lead := len(n.PreComments)
+	for lead > 0 && n.PreComments[lead-1] != "" {
+		lead--
+	}
+	leading := starts[0]
+	if lead > 0 {
+		var detached []Position
+		if len(leading) > 0 {
+			k := countLines(n.PreComments[:lead])
+			detached, leading = leading[:k], leading[k:]
+		}
+		addLines(DetachedComment, nil, n.PreComments[:lead-1], detached)
+		lead-- // Keep the blank line, which separates the leading comments from the detached ones.
+	}
+	addLines(LeadingComment, nil, n.PreComments[lead:], leading)
+	for _, v := range n.Values {
+		vs := splitStarts(v.CommentStarts, v.PreComments, []string{v.InlineComment})
+		addLines(LeadingComment, v, v.PreComments, vs[0])
+		if v.InlineComment != "" {
+			addLines(TrailingComment, v, []string{v.InlineComment}, vs[1])
+		}
+	}
+	if c := n.closingNode(); c != nil {
+		addLines(ClosingComment, nil, c.PreComments, splitStarts(c.CommentStarts, c.PreComments)[0])
+	}
+	addLines(ClosingComment, nil, n.PostValuesComments, starts[1])
+	if n.ClosingBraceComment != "" {
+		addLines(TrailingComment, nil, []string{n.ClosingBraceComment}, starts[2])
+	}
+	return res
+}
+
+// splitStarts returns the positions of the non-empty lines of each of groups, given the positions
+// of all of them in starts. If starts doesn't hold one position for each line, the positions are
+// unknown and nil is returned for every group.
+func splitStarts(starts []Position, groups ...[]string) [][]Position {
+	res := make([][]Position, len(groups))
+	total := 0
+	for _, g := range groups {
+		total += countLines(g)
+	}
+	if total != len(starts) {
+		return res
+	}
+	for i, g := range groups {
+		k := countLines(g)
+		res[i], starts = starts[:k:k], starts[k:]
+	}
+	return res
+}
+
+// countLines returns the number of non-empty lines, i.e. of comments, of lines.
+func countLines(lines []string) int {
+	n := 0
+	for _, l := range lines {
+		if l != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// after returns the position after text starting at p, which doesn't contain a newline.
+func (p Position) after(text string) Position {
+	return Position{Byte: p.Byte + uint32(len(text)), Line: p.Line, Column: p.Column + int32(len(text))}
+}
+
+// closingNode returns the comment-only last child of a message, which holds its closing comments.
+func (n *Node) closingNode() *Node {
+	if len(n.Children) == 0 {
+		return nil
+	}
+	c := n.Children[len(n.Children)-1]
+	if c.Deleted || c.Raw != "" || !c.IsCommentOnly() || c.IsBlankLine() || len(c.PreComments) == 0 {
+		return nil
+	}
+	return c
+}
+
+// SetComments replaces the comments of n with cs, which are placed according to their kind:
+//   - detached comments before the field, followed by a blank line, then leading comments,
+//   - comments of values with those values; comments of values that aren't values of n are
+//     attached to n itself,
+//   - a trailing comment after the last value of a scalar field, or after the closing bracket of a
+//     message or list, replacing any previous one,
+//   - closing comments before the closing bracket of a message or value list.
+//
+// All comments of a comment-only node are detached. A blank line before the node is kept.
+func (n *Node) SetComments(cs []Comment) {
+	if n.IsCommentOnly() {
+		n.PreComments = appendComments(keepBlankLine(n.PreComments), cs)
+		n.CommentStarts = startsOf(cs)
+		return
+	}
+	values := map[*Value]bool{}
+	for _, v := range n.Values {
+		values[v] = true
+		v.PreComments = nil
+		v.InlineComment = ""
+	}
+	closingPre := keepBlankLine(n.PostValuesComments)
+	if c := n.closingNode(); c != nil {
+		closingPre = keepBlankLine(c.PreComments)
+		n.Children = n.Children[:len(n.Children)-1]
+	}
+	n.PostValuesComments = nil
+	n.ClosingBraceComment = ""
+
+	var detached, leading, trailing, closing []Comment
+	valueComments := map[*Value][]Comment{}
+	valueTrailing := map[*Value][]Comment{}
+	for _, c := range cs {
+		switch {
+		case c.Kind == DetachedComment:
+			detached = append(detached, c)
+		case c.Kind == LeadingComment && values[c.Value]:
+			c.Value.PreComments = appendComments(c.Value.PreComments, []Comment{c})
+			valueComments[c.Value] = append(valueComments[c.Value], c)
+		case c.Kind == LeadingComment:
+			leading = append(leading, c)
+		case c.Kind == TrailingComment && values[c.Value]:
+			c.Value.InlineComment = c.String()
+			valueTrailing[c.Value] = []Comment{c}
+		case c.Kind == TrailingComment && (n.Children != nil || n.ValuesAsList || len(n.Values) == 0):
+			n.ClosingBraceComment = c.String()
+			trailing = []Comment{c}
+		case c.Kind == TrailingComment:
+			v := n.Values[len(n.Values)-1]
+			v.InlineComment = c.String()
+			valueTrailing[v] = []Comment{c}
+		case c.Kind == ClosingComment:
+			closing = append(closing, c)
+		}
+	}
+	for v := range values {
+		v.CommentStarts = startsOf(valueComments[v], valueTrailing[v])
+	}
+	pre := appendComments(keepBlankLine(n.PreComments), detached)
+	if len(detached) > 0 {
+		pre = append(pre, "")
+	}
+	n.PreComments = appendComments(pre, leading)
+	switch {
+	case len(closing) == 0:
+	case n.Children != nil:
+		n.Children = append(n.Children, &Node{PreComments: appendComments(closingPre, closing), CommentStarts: startsOf(closing)})
+		closing = nil
+	default:
+		n.PostValuesComments = appendComments(closingPre, closing)
+	}
+	n.CommentStarts = startsOf(detached, leading, closing, trailing)
+}
+
+// startsOf returns the start positions of the comments of groups, which are zero for those that
+// aren't known, or nil if none is known.
+func startsOf(groups ...[]Comment) []Position {
+	var res []Position
+	known := false
+	for _, g := range groups {
+		for _, c := range g {
+			res = append(res, c.Start)
+			known = known || c.Start.Line > 0
+		}
+	}
+	if !known {
+		return nil
+	}
+	return res
+}
+
+// AddComment adds c to the comments of n, after the other comments of its kind.
+func (n *Node) AddComment(c Comment) {
+	n.SetComments(append(n.Comments(), c))
+}
+
+// DetachComments removes the comments of n and returns them.
+func (n *Node) DetachComments() []Comment {
+	cs := n.Comments()
+	n.SetComments(nil)
+	return cs
+}
+
+// MoveComments moves the comments of from to to, after the comments of to, e.g. when replacing from
+// with to. Comments of the values of from are attached to to itself.
+func MoveComments(from, to *Node) {
+	to.SetComments(append(to.Comments(), from.DetachComments()...))
+}
+
+// CommentNode returns a comment-only node with a comment for each of texts, e.g. to add a header to
+// a file.
+func CommentNode(texts ...string) *Node {
+	nd := &Node{}
+	for _, t := range texts {
+		nd.PreComments = append(nd.PreComments, Comment{Text: t}.String())
+	}
+	return nd
+}
+
+// keepBlankLine returns the blank line starting lines, if any.
+func keepBlankLine(lines []string) []string {
+	if len(lines) > 0 && lines[0] == "" {
+		return []string{""}
+	}
+	return nil
+}
+
+// appendComments appends the lines of cs to lines, with a blank line before those separated by one.
+func appendComments(lines []string, cs []Comment) []string {
+	for _, c := range cs {
+		if c.BlankLineBefore && len(lines) > 0 && lines[len(lines)-1] != "" {
+			lines = append(lines, "")
+		}
+		lines = append(lines, c.String())
+	}
+	return lines
+}
@@ -0,0 +1,196 @@
+package ast_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kylelemons/godebug/diff"
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/parser"
+)
+
+const commentInput = `# File comment.
+
+# Leading.
+#
+# More.
+job {  # After brace.
+  name: "a"  # Name.
+  tags: [
+    # Tag.
+    "x",  # X.
+
+    # Last tag.
+  ]  # Tags.
+  # End of job.
+}  # Job.
+`
+
+func formatComments(cs []ast.Comment) []string {
+	var res []string
+	for _, c := range cs {
+		s := fmt.Sprintf("%d %s %q", c.Start.Line, c.Kind, c.Text)
+		if c.BlankLineBefore {
+			s += " after blank line"
+		}
+		if c.Value != nil {
+			s += " of " + c.Value.Value
+		}
+		res = append(res, s)
+	}
+	return res
+}
+
+func TestComments(t *testing.T) {
+	nodes, err := parser.Parse([]byte(commentInput))
+	if err != nil {
+		t.Fatalf("Parse returned err %v", err)
+	}
+	job := nodes[1]
+	inputs := []struct {
+		name string
+		nd   *ast.Node
+		want []string
+	}{{
+		name: "comment-only node",
+		nd:   nodes[0],
+		want: []string{`1 detached "File comment."`},
+	}, {
+		name: "message",
+		nd:   job,
+		want: []string{
+			`3 leading "Leading."`,
+			`4 leading ""`,
+			`5 leading "More."`,
+			`14 closing "End of job."`,
+			`15 trailing "Job."`,
+		},
+	}, {
+		name: "scalar",
+		nd:   job.Children[0],
+		want: []string{
+			`6 leading "After brace."`,
+			`7 trailing "Name." of "a"`,
+		},
+	}, {
+		name: "list",
+		nd:   job.Children[1],
+		want: []string{
+			`9 leading "Tag." of "x"`,
+			`10 trailing "X." of "x"`,
+			`12 closing "Last tag."`,
+			`13 trailing "Tags."`,
+		},
+	}}
+	for _, input := range inputs {
+		if diff := cmp.Diff(input.want, formatComments(input.nd.Comments())); diff != "" {
+			t.Errorf("%s: Comments returned diff (-want, +got):\n%s", input.name, diff)
+		}
+	}
+
+	// Setting the comments that were read leaves the file unchanged.
+	want := parser.Pretty(nodes, 0)
+	ast.Inspect(nodes, func(_ []*ast.Node, n *ast.Node) bool {
+		n.SetComments(n.Comments())
+		return true
+	})
+	if diff := diff.Diff(want, parser.Pretty(nodes, 0)); diff != "" {
+		t.Errorf("SetComments(Comments()) returned diff (-want, +got):\n%s", diff)
+	}
+}
+
+func TestCommentPositions(t *testing.T) {
+	in := "# File.\n\njob {\n  # Name.\n  name: \"a\"  # A.\n  tags: [\"x\", # X.\n  ]\n}  # Job.\n"
+	nodes, err := parser.Parse([]byte(in))
+	if err != nil {
+		t.Fatalf("Parse returned err %v", err)
+	}
+	var got []string
+	ast.Inspect(nodes, func(_ []*ast.Node, n *ast.Node) bool {
+		for _, c := range n.Comments() {
+			got = append(got, fmt.Sprintf("%d:%d-%d:%d %d-%d %q", c.Start.Line, c.Start.Column, c.End.Line, c.End.Column, c.Start.Byte, c.End.Byte, in[c.Start.Byte:c.End.Byte]))
+		}
+		return true
+	})
+	want := []string{
+		`1:1-1:8 0-7 "# File."`,
+		`8:4-8:10 69-75 "# Job."`,
+		`4:3-4:10 17-24 "# Name."`,
+		`5:14-5:18 38-42 "# A."`,
+		`6:15-6:19 57-61 "# X."`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Comments returned diff (-want, +got):\n%s", diff)
+	}
+
+	// Positions are kept when setting comments with positions, and unknown for new ones.
+	job := nodes[1]
+	job.AddComment(ast.Comment{Kind: ast.DetachedComment, Text: "New."})
+	got = nil
+	for _, c := range job.Comments() {
+		got = append(got, fmt.Sprintf("%d:%d %q", c.Start.Line, c.Start.Column, c.Text))
+	}
+	want = []string{`0:0 "New."`, `8:4 "Job."`}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("after AddComment, Comments returned diff (-want, +got):\n%s", diff)
+	}
+	name := job.Children[0]
+	name.SetComments(name.Comments())
+	if cs := name.Comments(); len(cs) != 2 || cs[0].Start.Byte != 17 || cs[1].Start.Byte != 38 {
+		t.Errorf("after SetComments(Comments()), Comments returned %+v, want positions kept", cs)
+	}
+}
+
+func TestEditComments(t *testing.T) {
+	nodes, err := parser.Parse([]byte(`# Old.
+a: 1
+b {
+  c: 2  # C.
+}
+d: [1, 2]
+`))
+	if err != nil {
+		t.Fatalf("Parse returned err %v", err)
+	}
+	a, b, d := nodes[0], nodes[1], nodes[2]
+	a.AddComment(ast.Comment{Kind: ast.DetachedComment, Text: "Auto-generated, do not edit."})
+	a.AddComment(ast.Comment{Kind: ast.TrailingComment, Text: "A."})
+	ast.MoveComments(b.Children[0], b)
+	b.AddComment(ast.Comment{Kind: ast.ClosingComment, Text: "Closing."})
+	d.SetComments([]ast.Comment{
+		{Kind: ast.LeadingComment, Text: "D."},
+		{Kind: ast.TrailingComment, Text: "Two.", Value: d.Values[1]},
+		{Kind: ast.ClosingComment, Text: "Closing."},
+	})
+	d.Fix()
+	nodes = append(nodes, ast.CommentNode("Last.", "", "End."))
+	want := `# Auto-generated, do not edit.
+
+# Old.
+a: 1  # A.
+b {
+  c: 2
+  # Closing.
+}  # C.
+# D.
+d: [
+  1,
+  2  # Two.
+  # Closing.
+]
+# Last.
+#
+# End.
+`
+	if diff := diff.Diff(want, parser.Pretty(nodes, 0)); diff != "" {
+		t.Errorf("editing comments returned diff (-want, +got):\n%s", diff)
+	}
+
+	if cs := a.DetachComments(); len(cs) != 3 {
+		t.Errorf("DetachComments returned %d comments, want 3", len(cs))
+	}
+	if got := parser.Pretty(nodes[:1], 0); got != "a: 1\n" {
+		t.Errorf("after DetachComments, got %q, want %q", got, "a: 1\n")
+	}
+}
@@ -0,0 +1,195 @@
+package ast
+
+import "sort"
+
+type equalOptions struct {
+	ignoreComments   bool
+	ignorePositions  bool
+	ignoreFieldOrder bool
+	ignoreStyle      bool
+	ignoreListStyle  bool
+}
+
+// An EqualOption configures Equal.
+type EqualOption func(*equalOptions)
+
+// IgnoreComments makes Equal ignore comments, including comment-only nodes and blank lines.
+func IgnoreComments() EqualOption {
+	return func(o *equalOptions) {
+		o.ignoreComments = true
+	}
+}
+
+// IgnorePositions makes Equal ignore the positions of nodes and values.
+func IgnorePositions() EqualOption {
+	return func(o *equalOptions) {
+		o.ignorePositions = true
+	}
+}
+
+// IgnoreFieldOrder makes Equal ignore the order of fields with different names. The order of
+// fields with the same name, i.e. of the values of a repeated field, still matters.
+func IgnoreFieldOrder() EqualOption {
+	return func(o *equalOptions) {
+		o.ignoreFieldOrder = true
+	}
+}
+
+// IgnoreStyle makes Equal ignore whether colons are omitted, whether messages use curly braces or
+// angle brackets, and whether children or values are on the same line as the field name.
+func IgnoreStyle() EqualOption {
+	return func(o *equalOptions) {
+		o.ignoreStyle = true
+	}
+}
+
+// IgnoreListStyle makes Equal treat lists (e.g. "a: [1, 2]") as the corresponding repeated fields
+// (e.g. "a: 1 a: 2").
+func IgnoreListStyle() EqualOption {
+	return func(o *equalOptions) {
+		o.ignoreListStyle = true
+	}
+}
+
+// Equal reports whether the two trees are equal. Without options, all fields of the nodes and
+// values are compared, except for Deleted nodes, which are ignored as they are by the printer.
+// Values are compared as written, e.g. 1 and 0x1 are different.
+func Equal(a, b []*Node, opts ...EqualOption) bool {
+	o := &equalOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o.equalNodes(a, b)
+}
+
+func (o *equalOptions) equalNodes(a, b []*Node) bool {
+	a, b = o.normalize(a), o.normalize(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !o.equalNode(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalize returns the nodes to compare, after removing the nodes to ignore, expanding lists and
+// sorting.
+func (o *equalOptions) normalize(nodes []*Node) []*Node {
+	var res []*Node
+	for _, nd := range nodes {
+		switch {
+		case nd.Deleted || (o.ignoreComments && nd.IsCommentOnly()):
+		case o.ignoreListStyle && (nd.ValuesAsList || nd.ChildrenAsList):
+			res = append(res, expandList(nd)...)
+		default:
+			res = append(res, nd)
+		}
+	}
+	if o.ignoreFieldOrder {
+		sort.SliceStable(res, func(i, j int) bool {
+			return res[i].Name < res[j].Name
+		})
+	}
+	return res
+}
+
+// expandList returns the repeated fields corresponding to a list. The comments before the list are
+// attached to the first field; those of the list items stay with them.
+func expandList(nd *Node) []*Node {
+	var res []*Node
+	if nd.ValuesAsList {
+		for _, v := range nd.Values {
+			c := *nd
+			c.PreComments, c.PostValuesComments, c.ClosingBraceComment, c.CommentStarts = nil, nil, "", nil
+			c.Values = []*Value{v}
+			c.ValuesAsList = false
+			res = append(res, &c)
+		}
+	} else {
+		for _, item := range nd.Children {
+			if item.Deleted || item.IsCommentOnly() {
+				continue
+			}
+			c := *item
+			c.Name = nd.Name
+			c.SkipColon = nd.SkipColon
+			res = append(res, &c)
+		}
+	}
+	if len(res) > 0 {
+		res[0].PreComments = append(cloneStrings(nd.PreComments), res[0].PreComments...)
+	}
+	return res
+}
+
+func (o *equalOptions) equalNode(a, b *Node) bool {
+	if a.Name != b.Name || a.Raw != b.Raw || a.SyntaxError != b.SyntaxError {
+		return false
+	}
+	if (a.Children == nil) != (b.Children == nil) || len(a.Values) != len(b.Values) {
+		return false
+	}
+	if !o.ignorePositions && (a.Start != b.Start || a.End != b.End ||
+		a.FieldStart != b.FieldStart || a.FieldEnd != b.FieldEnd) {
+		return false
+	}
+	if !o.ignoreComments && (!equalStrings(a.PreComments, b.PreComments) ||
+		!equalStrings(a.PostValuesComments, b.PostValuesComments) ||
+		a.ClosingBraceComment != b.ClosingBraceComment) {
+		return false
+	}
+	if !o.ignoreComments && !o.ignorePositions && !equalPositions(a.CommentStarts, b.CommentStarts) {
+		return false
+	}
+	if !o.ignoreStyle && (a.SkipColon != b.SkipColon || a.IsAngleBracket != b.IsAngleBracket ||
+		a.ChildrenSameLine != b.ChildrenSameLine || a.Separator != b.Separator ||
+		a.PutSingleValueOnNextLine != b.PutSingleValueOnNextLine) {
+		return false
+	}
+	if !o.ignoreListStyle && (a.ValuesAsList != b.ValuesAsList || a.ChildrenAsList != b.ChildrenAsList) {
+		return false
+	}
+	for i, v := range a.Values {
+		w := b.Values[i]
+		if v.Value != w.Value {
+			return false
+		}
+		if !o.ignorePositions && (v.Start != w.Start || v.End != w.End) {
+			return false
+		}
+		if !o.ignoreComments && (!equalStrings(v.PreComments, w.PreComments) || v.InlineComment != w.InlineComment) {
+			return false
+		}
+		if !o.ignoreComments && !o.ignorePositions && !equalPositions(v.CommentStarts, w.CommentStarts) {
+			return false
+		}
+	}
+	return o.equalNodes(a.Children, b.Children)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalPositions(a, b []Position) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,185 @@
+package ast_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/parser"
+)
+
+func TestClone(t *testing.T) {
+	nodes, err := parser.Parse([]byte(`# Comment.
+job {
+  name: "foo"  # Inline.
+  tags: [
+    "a",
+    # Last.
+  ]
+  task <>
+}
+`))
+	if err != nil {
+		t.Fatalf("Parse returned err %v", err)
+	}
+	orig := nodes[0]
+	clone := orig.Clone()
+	if diff := cmp.Diff(orig, clone); diff != "" {
+		t.Errorf("Clone returned diff (-want, +got):\n%s", diff)
+	}
+	want := parser.Pretty(nodes, 0)
+	clone.PreComments[0] = "# Changed."
+	clone.Children[0].Values[0].Value = `"bar"`
+	clone.Children[0].Values[0].InlineComment = ""
+	clone.Children[1].PostValuesComments[0] = ""
+	clone.Children = append(clone.Children[:1], clone.Children[2:]...)
+	if got := parser.Pretty(nodes, 0); got != want {
+		t.Errorf("changing the clone changed the original to:\n%s", got)
+	}
+	if task := clone.Children[1].Clone(); task.Children == nil {
+		t.Errorf("Clone of empty message returned nil children")
+	}
+}
+
+func TestCloneAndEqualCoverAllFields(t *testing.T) {
+	// Clone and Equal must be updated when fields are added.
+	if got, want := reflect.TypeOf(ast.Node{}).NumField(), 21; got != want {
+		t.Errorf("ast.Node has %d fields, want %d", got, want)
+	}
+	if got, want := reflect.TypeOf(ast.Value{}).NumField(), 6; got != want {
+		t.Errorf("ast.Value has %d fields, want %d", got, want)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	inputs := []struct {
+		name string
+		a    string
+		b    string
+		opts []ast.EqualOption
+		want bool
+	}{{
+		name: "same",
+		a:    "a: 1\nb { c: 2 }\n",
+		b:    "a: 1\nb { c: 2 }\n",
+		want: true,
+	}, {
+		name: "different value",
+		a:    "a: 1\n",
+		b:    "a: 2\n",
+		opts: []ast.EqualOption{ast.IgnoreComments(), ast.IgnorePositions(), ast.IgnoreFieldOrder(), ast.IgnoreStyle(), ast.IgnoreListStyle()},
+		want: false,
+	}, {
+		name: "message and scalar",
+		a:    "a {}\n",
+		b:    "a: []\n",
+		opts: []ast.EqualOption{ast.IgnoreStyle(), ast.IgnoreListStyle()},
+		want: false,
+	}, {
+		name: "comments",
+		a:    "# Comment.\na: 1  # Inline.\n\n# Trailing.\n",
+		b:    "a: 1\n",
+		want: false,
+	}, {
+		name: "ignore comments",
+		a:    "# Comment.\na: 1  # Inline.\n\n# Trailing.\n",
+		b:    "a: 1\n",
+		opts: []ast.EqualOption{ast.IgnoreComments(), ast.IgnorePositions()},
+		want: true,
+	}, {
+		name: "positions",
+		a:    "a: 1\n",
+		b:    "\na: 1\n",
+		opts: []ast.EqualOption{ast.IgnoreComments()},
+		want: false,
+	}, {
+		name: "comment positions",
+		a:    "a: 1  # A.\n",
+		b:    "a: 1   # A.\n",
+		want: false,
+	}, {
+		name: "ignore positions",
+		a:    "a {\n  b: 1\n}\n",
+		b:    "a {\n\n  b: 1\n\n}\n",
+		opts: []ast.EqualOption{ast.IgnoreComments(), ast.IgnorePositions()},
+		want: true,
+	}, {
+		name: "field order",
+		a:    "a: 1\nb: 2\n",
+		b:    "b: 2\na: 1\n",
+		opts: []ast.EqualOption{ast.IgnorePositions()},
+		want: false,
+	}, {
+		name: "ignore field order",
+		a:    "a: 1\nb: 2\na: 3\nc { d: 4 e: 5 }\n",
+		b:    "c { e: 5 d: 4 }\nb: 2\na: 1\na: 3\n",
+		opts: []ast.EqualOption{ast.IgnorePositions(), ast.IgnoreFieldOrder()},
+		want: true,
+	}, {
+		name: "ignore field order keeps order of repeated fields",
+		a:    "a: 1\na: 3\n",
+		b:    "a: 3\na: 1\n",
+		opts: []ast.EqualOption{ast.IgnorePositions(), ast.IgnoreFieldOrder()},
+		want: false,
+	}, {
+		name: "style",
+		a:    "a: { b: 1 }\n",
+		b:    "a <\n  b: 1\n>\n",
+		opts: []ast.EqualOption{ast.IgnorePositions()},
+		want: false,
+	}, {
+		name: "ignore style",
+		a:    "a: { b: 1 }\n",
+		b:    "a <\n  b: 1\n>\n",
+		opts: []ast.EqualOption{ast.IgnorePositions(), ast.IgnoreStyle()},
+		want: true,
+	}, {
+		name: "list style",
+		a:    "a: [1, 2]\n",
+		b:    "a: 1\na: 2\n",
+		opts: []ast.EqualOption{ast.IgnorePositions()},
+		want: false,
+	}, {
+		name: "ignore list style",
+		a:    "a: [1, 2]\nb: [{ c: 1 }, { c: 2 }]\nd: []\n",
+		b:    "a: 1\na: 2\nb { c: 1 }\nb { c: 2 }\n",
+		opts: []ast.EqualOption{ast.IgnorePositions(), ast.IgnoreStyle(), ast.IgnoreListStyle()},
+		want: true,
+	}, {
+		name: "ignore list style keeps comments",
+		a:    "# Comment.\na: [1, 2]\n",
+		b:    "# Comment.\na: 1\na: 2\n",
+		opts: []ast.EqualOption{ast.IgnorePositions(), ast.IgnoreStyle(), ast.IgnoreListStyle()},
+		want: true,
+	}}
+	for _, input := range inputs {
+		a, err := parser.Parse([]byte(input.a))
+		if err != nil {
+			t.Fatalf("%s: Parse(%q) returned err %v", input.name, input.a, err)
+		}
+		b, err := parser.Parse([]byte(input.b))
+		if err != nil {
+			t.Fatalf("%s: Parse(%q) returned err %v", input.name, input.b, err)
+		}
+		if got := ast.Equal(a, b, input.opts...); got != input.want {
+			t.Errorf("%s: Equal(%q, %q) = %t, want %t", input.name, input.a, input.b, got, input.want)
+		}
+		if got := ast.Equal(b, a, input.opts...); got != input.want {
+			t.Errorf("%s: Equal(%q, %q) = %t, want %t", input.name, input.b, input.a, got, input.want)
+		}
+	}
+}
+
+func TestEqualDeleted(t *testing.T) {
+	a := []*ast.Node{{Name: "a"}, {Name: "b", Deleted: true}}
+	b := []*ast.Node{{Name: "a"}}
+	if !ast.Equal(a, b) {
+		t.Errorf("Equal with Deleted node returned false, want true")
+	}
+	clone := []*ast.Node{a[0].Clone()}
+	clone[0].Values = []*ast.Value{{Value: "1"}}
+	if ast.Equal(a, clone) {
+		t.Errorf("Equal after changing clone returned true, want false")
+	}
+}
@@ -0,0 +1,173 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NodeIndex is an indexed view of a tree, giving the parent, sibling index and path of its nodes.
+// It stays valid across edits made through its methods; after changing the tree otherwise, call
+// Reindex.
+type NodeIndex struct {
+	nodes []*Node
+	// parents maps each node of the tree to its parent, or to nil for top-level nodes.
+	parents map[*Node]*Node
+}
+
+// Index returns an index of nodes and their descendants.
+func Index(nodes []*Node) *NodeIndex {
+	x := &NodeIndex{nodes: nodes, parents: map[*Node]*Node{}}
+	x.add(nil, nodes)
+	return x
+}
+
+func (x *NodeIndex) add(parent *Node, nodes []*Node) {
+	for _, nd := range nodes {
+		x.parents[nd] = parent
+		x.add(nd, nd.Children)
+	}
+}
+
+func (x *NodeIndex) remove(nd *Node) {
+	delete(x.parents, nd)
+	for _, c := range nd.Children {
+		x.remove(c)
+	}
+}
+
+// Nodes returns the top-level nodes, which change when top-level nodes are inserted or removed.
+func (x *NodeIndex) Nodes() []*Node {
+	return x.nodes
+}
+
+// Reindex indexes the tree again, e.g. after changing it without the methods of x.
+func (x *NodeIndex) Reindex() {
+	*x = *Index(x.nodes)
+}
+
+// Contains reports whether nd is in the tree.
+func (x *NodeIndex) Contains(nd *Node) bool {
+	_, ok := x.parents[nd]
+	return ok
+}
+
+// Parent returns the parent of nd, or nil for top-level nodes and nodes that aren't in the tree.
+func (x *NodeIndex) Parent(nd *Node) *Node {
+	return x.parents[nd]
+}
+
+// Ancestors returns the ancestors of nd, starting with the top-level one.
+func (x *NodeIndex) Ancestors(nd *Node) []*Node {
+	var res []*Node
+	for p := x.parents[nd]; p != nil; p = x.parents[p] {
+		res = append(res, p)
+	}
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return res
+}
+
+// siblings returns the nodes among which nd is.
+func (x *NodeIndex) siblings(nd *Node) []*Node {
+	if p := x.parents[nd]; p != nil {
+		return p.Children
+	}
+	return x.nodes
+}
+
+// SiblingIndex returns the index of nd among the children of its parent, or among the top-level
+// nodes, or -1 if nd isn't in the tree.
+func (x *NodeIndex) SiblingIndex(nd *Node) int {
+	if !x.Contains(nd) {
+		return -1
+	}
+	for i, c := range x.siblings(nd) {
+		if c == nd {
+			return i
+		}
+	}
+	return -1
+}
+
+// Path returns the canonical path of nd, a query as described in the query package matching only
+// nd, e.g. `job[2].task[0].name`. Fields with siblings of the same name are followed by their index
+// among them, and unnamed messages are written as *. It returns the empty string for comment-only
+// and Deleted nodes, and for nodes that aren't in the tree.
+func (x *NodeIndex) Path(nd *Node) string {
+	if !x.Contains(nd) {
+		return ""
+	}
+	var steps []string
+	for ; nd != nil; nd = x.parents[nd] {
+		if nd.Deleted || nd.IsCommentOnly() {
+			return ""
+		}
+		name := nd.Name
+		if name == "" {
+			name = "*"
+		}
+		count, index := 0, 0
+		for _, c := range x.siblings(nd) {
+			if c.Deleted || c.IsCommentOnly() || (nd.Name != "" && c.Name != nd.Name) {
+				continue
+			}
+			if c == nd {
+				index = count
+			}
+			count++
+		}
+		if count > 1 {
+			name = fmt.Sprintf("%s[%d]", name, index)
+		}
+		steps = append(steps, name)
+	}
+	for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+		steps[i], steps[j] = steps[j], steps[i]
+	}
+	return strings.Join(steps, ".")
+}
+
+// Insert inserts nd and its descendants into the children of parent, or into the top-level nodes if
+// parent is nil, at index i. An index out of range appends nd.
+func (x *NodeIndex) Insert(parent *Node, i int, nd *Node) {
+	nodes := &x.nodes
+	if parent != nil {
+		nodes = &parent.Children
+	}
+	if i < 0 || i > len(*nodes) {
+		i = len(*nodes)
+	}
+	*nodes = append(*nodes, nil)
+	copy((*nodes)[i+1:], (*nodes)[i:])
+	(*nodes)[i] = nd
+	x.parents[nd] = parent
+	x.add(nd, nd.Children)
+}
+
+// Remove removes nd and its descendants from the tree. It does nothing if nd isn't in the tree.
+func (x *NodeIndex) Remove(nd *Node) {
+	i := x.SiblingIndex(nd)
+	if i < 0 {
+		return
+	}
+	if p := x.parents[nd]; p != nil {
+		p.Children = append(p.Children[:i:i], p.Children[i+1:]...)
+	} else {
+		x.nodes = append(x.nodes[:i:i], x.nodes[i+1:]...)
+	}
+	x.remove(nd)
+}
+
+// Replace replaces old with nd and its descendants. It does nothing if old isn't in the tree.
+func (x *NodeIndex) Replace(old, nd *Node) {
+	i := x.SiblingIndex(old)
+	if i < 0 {
+		return
+	}
+	parent := x.parents[old]
+	x.siblings(old)[i] = nd
+	x.remove(old)
+	x.parents[nd] = parent
+	x.add(nd, nd.Children)
+}
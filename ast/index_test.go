@@ -0,0 +1,117 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kylelemons/godebug/diff"
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/parser"
+)
+
+const indexInput = `# Comment.
+
+job {
+  name: "a"
+  task { id: 1 }
+}
+job {
+  name: "b"
+  task { id: 2 }
+  task { id: 3 }
+  [com.ext] { x: 1 }
+}
+`
+
+func TestIndexPaths(t *testing.T) {
+	nodes, err := parser.Parse([]byte(indexInput))
+	if err != nil {
+		t.Fatalf("Parse returned err %v", err)
+	}
+	x := ast.Index(nodes)
+	var got []string
+	ast.Inspect(nodes, func(_ []*ast.Node, n *ast.Node) bool {
+		got = append(got, x.Path(n))
+		return true
+	})
+	want := []string{
+		"",
+		"job[0]", "job[0].name", "job[0].task", "job[0].task.id",
+		"job[1]", "job[1].name", "job[1].task[0]", "job[1].task[0].id", "job[1].task[1]", "job[1].task[1].id",
+		"job[1].[com.ext]", "job[1].[com.ext].x",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Path returned diff (-want, +got):\n%s", diff)
+	}
+
+	id := nodes[2].Children[2].Children[0]
+	if got, want := x.Parent(id), nodes[2].Children[2]; got != want {
+		t.Errorf("Parent(%s) = %v, want %v", x.Path(id), got, want)
+	}
+	if got := x.Parent(nodes[1]); got != nil {
+		t.Errorf("Parent of top-level node = %v, want nil", got)
+	}
+	if got := x.Ancestors(id); len(got) != 2 || got[0] != nodes[2] || got[1] != nodes[2].Children[2] {
+		t.Errorf("Ancestors(%s) = %v", x.Path(id), got)
+	}
+	if got := x.SiblingIndex(nodes[2].Children[3]); got != 3 {
+		t.Errorf("SiblingIndex = %d, want 3", got)
+	}
+	if other := (&ast.Node{Name: "job"}); x.Contains(other) || x.SiblingIndex(other) != -1 || x.Path(other) != "" {
+		t.Errorf("node outside the tree is indexed")
+	}
+}
+
+func TestIndexEdits(t *testing.T) {
+	nodes, err := parser.Parse([]byte(indexInput))
+	if err != nil {
+		t.Fatalf("Parse returned err %v", err)
+	}
+	x := ast.Index(nodes)
+	job0, job1 := nodes[1], nodes[2]
+	task := job1.Children[2]
+
+	x.Remove(job1.Children[1])
+	if got, want := x.Path(task), "job[1].task"; got != want {
+		t.Errorf("Path after Remove = %q, want %q", got, want)
+	}
+	moved := job0.Children[1]
+	x.Remove(moved)
+	x.Insert(job1, 1, moved)
+	if got, want := x.Path(moved.Children[0]), "job[1].task[0].id"; got != want {
+		t.Errorf("Path after Insert = %q, want %q", got, want)
+	}
+	if got := x.Parent(moved); got != job1 {
+		t.Errorf("Parent after Insert = %v, want %v", got, job1)
+	}
+	top := &ast.Node{Name: "version", Values: []*ast.Value{{Value: "2"}}}
+	x.Insert(nil, 1, top)
+	x.Replace(job0, &ast.Node{Name: "archived", Children: []*ast.Node{job0.Children[0]}, SkipColon: true})
+	if x.Contains(job0) {
+		t.Errorf("replaced node is still indexed")
+	}
+	if got, want := x.Path(job1), "job"; got != want {
+		t.Errorf("Path after Replace = %q, want %q", got, want)
+	}
+	want := `# Comment.
+version: 2
+archived {
+  name: "a"
+}
+job {
+  name: "b"
+  task { id: 1 }
+  task { id: 3 }
+  [com.ext] { x: 1 }
+}
+`
+	if diff := diff.Diff(want, parser.Pretty(x.Nodes(), 0)); diff != "" {
+		t.Errorf("edits returned diff (-want, +got):\n%s", diff)
+	}
+
+	job1.Children = job1.Children[:1]
+	x.Reindex()
+	if x.Contains(task) {
+		t.Errorf("node removed outside the index is still indexed after Reindex")
+	}
+}
@@ -0,0 +1,37 @@
+package ast
+
+// NodeAt returns the innermost node whose source contains pos, from the Start of the node, which
+// includes its comments, to its FieldEnd. If pos is within one of the values of that node, it also
+// returns the value. If pos.Line is set, pos is looked up by line and column, otherwise by byte
+// offset. Deleted nodes and nodes without positions, e.g. added by edits, are skipped.
+func NodeAt(nodes []*Node, pos Position) (*Node, *Value) {
+	for _, nd := range nodes {
+		if nd.Deleted || !isRealPosition(nd.FieldEnd) || !pos.within(nd.Start, nd.FieldEnd) {
+			continue
+		}
+		if c, v := NodeAt(nd.Children, pos); c != nil {
+			return c, v
+		}
+		for _, v := range nd.Values {
+			if isRealPosition(v.End) && pos.within(v.Start, v.End) {
+				return nd, v
+			}
+		}
+		return nd, nil
+	}
+	return nil, nil
+}
+
+// within reports whether p is in the range from start, inclusive, to end, exclusive.
+func (p Position) within(start, end Position) bool {
+	return !p.before(start) && p.before(end)
+}
+
+// before reports whether p precedes q, comparing lines and columns if p.Line is set and bytes
+// otherwise.
+func (p Position) before(q Position) bool {
+	if p.Line > 0 {
+		return p.Line < q.Line || (p.Line == q.Line && p.Column < q.Column)
+	}
+	return p.Byte < q.Byte
+}
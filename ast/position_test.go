@@ -0,0 +1,85 @@
+package ast_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/parser"
+)
+
+func TestNodeAt(t *testing.T) {
+	const in = `# Comment.
+job {
+  name: "a"  # Inline.
+  tags: ["x", "y"]
+  task { id: 1 }
+}
+`
+	nodes, err := parser.Parse([]byte(in))
+	if err != nil {
+		t.Fatalf("Parse returned err %v", err)
+	}
+	inputs := []struct {
+		name      string
+		pos       ast.Position
+		wantNode  string
+		wantValue string
+	}{{
+		name:     "comment",
+		pos:      ast.Position{Byte: 2},
+		wantNode: "job",
+	}, {
+		name:     "field name",
+		pos:      ast.Position{Byte: uint32(strings.Index(in, "name"))},
+		wantNode: "name",
+	}, {
+		name:      "value",
+		pos:       ast.Position{Byte: uint32(strings.Index(in, `"a"`)) + 1},
+		wantNode:  "name",
+		wantValue: `"a"`,
+	}, {
+		name:     "inline comment",
+		pos:      ast.Position{Byte: uint32(strings.Index(in, "Inline"))},
+		wantNode: "job",
+	}, {
+		name:      "list value by line and column",
+		pos:       ast.Position{Line: 4, Column: 15},
+		wantNode:  "tags",
+		wantValue: `"y"`,
+	}, {
+		name:      "nested value",
+		pos:       ast.Position{Line: 5, Column: 14},
+		wantNode:  "id",
+		wantValue: "1",
+	}, {
+		name:     "between fields",
+		pos:      ast.Position{Line: 5, Column: 8},
+		wantNode: "task",
+	}, {
+		name:     "closing brace",
+		pos:      ast.Position{Line: 6, Column: 1},
+		wantNode: "job",
+	}, {
+		name: "after end",
+		pos:  ast.Position{Line: 7, Column: 1},
+	}}
+	for _, input := range inputs {
+		nd, v := ast.NodeAt(nodes, input.pos)
+		gotNode, gotValue := "", ""
+		if nd != nil {
+			gotNode = nd.Name
+		}
+		if v != nil {
+			gotValue = v.Value
+		}
+		if gotNode != input.wantNode || gotValue != input.wantValue {
+			t.Errorf("%s: NodeAt(%+v) = %q, %q, want %q, %q", input.name, input.pos, gotNode, gotValue, input.wantNode, input.wantValue)
+		}
+	}
+
+	nodes[0].Children[0].Deleted = true
+	if nd, _ := ast.NodeAt(nodes, ast.Position{Line: 3, Column: 4}); nd != nodes[0] {
+		t.Errorf("NodeAt returned %v for a position in a deleted node, want its parent", nd)
+	}
+}
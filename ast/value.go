@@ -0,0 +1,335 @@
+package ast
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// AsInt64 returns the value of an integer literal, given in decimal, octal (e.g. 017) or
+// hexadecimal (e.g. 0x1F) form.
+func (v *Value) AsInt64() (int64, error) {
+	neg, u, err := v.parseInt()
+	if err != nil {
+		return 0, err
+	}
+	if neg {
+		if u > 1<<63 {
+			return 0, fmt.Errorf("%s is out of range for int64", v.Value)
+		}
+		return -int64(u), nil
+	}
+	if u > math.MaxInt64 {
+		return 0, fmt.Errorf("%s is out of range for int64", v.Value)
+	}
+	return int64(u), nil
+}
+
+// AsUint64 returns the value of a non-negative integer literal, as AsInt64 does.
+func (v *Value) AsUint64() (uint64, error) {
+	neg, u, err := v.parseInt()
+	if err != nil {
+		return 0, err
+	}
+	if neg && u != 0 {
+		return 0, fmt.Errorf("%s is out of range for uint64", v.Value)
+	}
+	return u, nil
+}
+
+// parseInt returns the sign and the absolute value of an integer literal.
+func (v *Value) parseInt() (neg bool, u uint64, err error) {
+	s := strings.TrimPrefix(v.Value, "-")
+	neg = len(s) < len(v.Value)
+	digits, base := intDigits(s)
+	if digits == "" {
+		return false, 0, fmt.Errorf("%s is not an integer", v.Value)
+	}
+	u, err = strconv.ParseUint(digits, base, 64)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return false, 0, fmt.Errorf("%s is out of range", v.Value)
+		}
+		return false, 0, fmt.Errorf("%s is not an integer", v.Value)
+	}
+	return neg, u, nil
+}
+
+// intDigits returns the digits of an unsigned integer literal and their base, or the empty string
+// if s isn't one.
+func intDigits(s string) (string, int) {
+	switch {
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		return s[2:], 16
+	case len(s) > 1 && s[0] == '0':
+		return s[1:], 8
+	case s == "" || s[0] < '0' || s[0] > '9':
+		// ParseUint would accept a leading '+'.
+		return "", 10
+	}
+	return s, 10
+}
+
+// AsFloat64 returns the value of a floating-point literal (e.g. 1.5, .5e-3, 2f, -inf or nan), or
+// of an integer literal.
+func (v *Value) AsFloat64() (float64, error) {
+	s := strings.TrimPrefix(v.Value, "-")
+	neg := len(s) < len(v.Value)
+	var f float64
+	switch strings.ToLower(s) {
+	case "inf", "infinity":
+		f = math.Inf(1)
+	case "nan":
+		f = math.NaN()
+	default:
+		// Octal literals are only told apart from floats with a leading zero by their digits.
+		if digits, base := intDigits(s); base == 16 || base == 8 && strings.Trim(digits, "01234567") == "" {
+			u, err := strconv.ParseUint(digits, base, 64)
+			if err != nil {
+				return 0, fmt.Errorf("%s is not a number", v.Value)
+			}
+			f = float64(u)
+			break
+		}
+		s = strings.TrimSuffix(strings.TrimSuffix(s, "f"), "F")
+		if s == "" || !(s[0] == '.' || '0' <= s[0] && s[0] <= '9') || strings.ContainsAny(s, "_xXpP") {
+			return 0, fmt.Errorf("%s is not a number", v.Value)
+		}
+		var err error
+		if f, err = strconv.ParseFloat(s, 64); err != nil && !errors.Is(err, strconv.ErrRange) {
+			return 0, fmt.Errorf("%s is not a number", v.Value)
+		}
+	}
+	if neg {
+		f = -f
+	}
+	return f, nil
+}
+
+// AsBool returns the value of a boolean literal: true, True, t or 1, or false, False, f or 0.
+func (v *Value) AsBool() (bool, error) {
+	switch v.Value {
+	case "true", "True", "t", "1":
+		return true, nil
+	case "false", "False", "f", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("%s is not a bool", v.Value)
+}
+
+// AsString returns the unquoted value of a string literal. Strings spanning several lines are
+// split into several Values; use unquote.Unquote to get the whole string of a Node.
+func (v *Value) AsString() (string, error) {
+	s := v.Value
+	if len(s) < 2 || (s[0] != '"' && s[0] != '\'') || s[len(s)-1] != s[0] {
+		return "", fmt.Errorf("%s is not a quoted string", s)
+	}
+	return unquoteC(s[1:len(s)-1], rune(s[0]))
+}
+
+// IsIdentifier reports whether the value is an identifier, such as an enum value name.
+func (v *Value) IsIdentifier() bool {
+	if v.Value == "" {
+		return false
+	}
+	for i, c := range []byte(v.Value) {
+		if !(c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || i > 0 && '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// IntValue returns a Value holding the decimal literal of i.
+func IntValue(i int64) *Value {
+	return &Value{Value: strconv.FormatInt(i, 10)}
+}
+
+// UintValue returns a Value holding the decimal literal of u.
+func UintValue(u uint64) *Value {
+	return &Value{Value: strconv.FormatUint(u, 10)}
+}
+
+// FloatValue returns a Value holding the shortest literal of f that reads back as f, using inf,
+// -inf and nan for the special values.
+func FloatValue(f float64) *Value {
+	switch {
+	case math.IsInf(f, 1):
+		return &Value{Value: "inf"}
+	case math.IsInf(f, -1):
+		return &Value{Value: "-inf"}
+	case math.IsNaN(f):
+		return &Value{Value: "nan"}
+	}
+	return &Value{Value: strconv.FormatFloat(f, 'g', -1, 64)}
+}
+
+// BoolValue returns a Value holding true or false.
+func BoolValue(b bool) *Value {
+	return &Value{Value: strconv.FormatBool(b)}
+}
+
+// EnumValue returns a Value holding the given enum value name.
+func EnumValue(name string) *Value {
+	return &Value{Value: name}
+}
+
+// StringValue returns a Value holding the double-quoted literal of s.
+func StringValue(s string) *Value {
+	return &Value{Value: strconv.Quote(s)}
+}
+
+// BytesValue returns a Value holding the double-quoted literal of b, with octal escapes for bytes
+// that aren't printable ASCII.
+func BytesValue(b []byte) *Value {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, c := range b {
+		switch c {
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(&sb, `\%03o`, c)
+			} else {
+				sb.WriteByte(c)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return &Value{Value: sb.String()}
+}
+
+var (
+	errBadUTF8 = errors.New("bad UTF-8")
+)
+
+func unquoteC(s string, quote rune) (string, error) {
+	// Copied from third_party/golang/protobuf/proto/text_parser.go
+
+	// This is based on C++'s tokenizer.cc.
+	// Despite its name, this is *not* parsing C syntax.
+	// For instance, "\0" is an invalid quoted string.
+
+	// Avoid allocation in trivial cases.
+	simple := true
+	for _, r := range s {
+		if r == '\\' || r == quote {
+			simple = false
+			break
+		}
+	}
+	if simple {
+		return s, nil
+	}
+
+	buf := make([]byte, 0, 3*len(s)/2)
+	for len(s) > 0 {
+		r, n := utf8.DecodeRuneInString(s)
+		if r == utf8.RuneError && n == 1 {
+			return "", errBadUTF8
+		}
+		s = s[n:]
+		if r != '\\' {
+			buf = appendRune(buf, r)
+			continue
+		}
+
+		ch, tail, err := unescape(s)
+		if err != nil {
+			return "", err
+		}
+		buf = append(buf, ch...)
+		s = tail
+	}
+	return string(buf), nil
+}
+
+func appendRune(buf []byte, r rune) []byte {
+	if r < utf8.RuneSelf {
+		return append(buf, byte(r))
+	}
+	return append(buf, string(r)...)
+}
+
+func unescape(s string) (ch string, tail string, err error) {
+	// Copied from third_party/golang/protobuf/proto/text_parser.go
+
+	r, n := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError && n == 1 {
+		return "", "", errBadUTF8
+	}
+	s = s[n:]
+	switch r {
+	case 'a':
+		return "\a", s, nil
+	case 'b':
+		return "\b", s, nil
+	case 'f':
+		return "\f", s, nil
+	case 'n':
+		return "\n", s, nil
+	case 'r':
+		return "\r", s, nil
+	case 't':
+		return "\t", s, nil
+	case 'v':
+		return "\v", s, nil
+	case '?':
+		return "?", s, nil // trigraph workaround
+	case '\'', '"', '\\':
+		return string(r), s, nil
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		return unescapeOctal(r, s)
+	case 'x', 'X':
+		return unescapeHex(r, s, 2)
+	case 'u':
+		return unescapeHex(r, s, 4)
+	case 'U':
+		return unescapeHex(r, s, 8)
+	}
+	return "", "", fmt.Errorf(`unknown escape \%c`, r)
+}
+
+func unescapeOctal(r rune, s string) (string, string, error) {
+	if len(s) < 2 {
+		return "", "", fmt.Errorf(`\%c requires 2 following digits`, r)
+	}
+	ss := string(r) + s[:2]
+	s = s[2:]
+	i, err := strconv.ParseUint(ss, 8, 8)
+	if err != nil {
+		return "", "", fmt.Errorf(`\%s contains non-octal digits`, ss)
+	}
+	return string([]byte{byte(i)}), s, nil
+}
+
+func unescapeHex(r rune, s string, n int) (string, string, error) {
+	if len(s) < n {
+		return "", "", fmt.Errorf(`\%c requires %d following digits`, r, n)
+	}
+	ss := s[:n]
+	s = s[n:]
+	i, err := strconv.ParseUint(ss, 16, 64)
+	if err != nil {
+		return "", "", fmt.Errorf(`\%c%s contains non-hexadecimal digits`, r, ss)
+	}
+	if r == 'x' || r == 'X' {
+		return string([]byte{byte(i)}), s, nil
+	}
+	if i > utf8.MaxRune || !utf8.ValidRune(rune(i)) {
+		return "", "", fmt.Errorf(`\%c%s is not a valid Unicode code point`, r, ss)
+	}
+	return string(rune(i)), s, nil
+}
@@ -0,0 +1,206 @@
+package ast_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/protocolbuffers/txtpbfmt/ast"
+)
+
+func TestAsInt64(t *testing.T) {
+	inputs := []struct {
+		in      string
+		want    int64
+		wantErr string
+	}{
+		{in: "0", want: 0},
+		{in: "42", want: 42},
+		{in: "-42", want: -42},
+		{in: "017", want: 15},
+		{in: "-0x1F", want: -31},
+		{in: "0X10", want: 16},
+		{in: "9223372036854775807", want: math.MaxInt64},
+		{in: "-9223372036854775808", want: math.MinInt64},
+		{in: "9223372036854775808", wantErr: "out of range"},
+		{in: "99999999999999999999", wantErr: "out of range"},
+		{in: "08", wantErr: "not an integer"},
+		{in: "1.5", wantErr: "not an integer"},
+		{in: "+1", wantErr: "not an integer"},
+		{in: "0x", wantErr: "not an integer"},
+		{in: "ENUM", wantErr: "not an integer"},
+		{in: `"1"`, wantErr: "not an integer"},
+	}
+	for _, input := range inputs {
+		got, err := (&ast.Value{Value: input.in}).AsInt64()
+		if input.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), input.wantErr) {
+				t.Errorf("AsInt64(%s) = %d, %v, want error containing %q", input.in, got, err, input.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != input.want {
+			t.Errorf("AsInt64(%s) = %d, %v, want %d", input.in, got, err, input.want)
+		}
+	}
+}
+
+func TestAsUint64(t *testing.T) {
+	inputs := []struct {
+		in      string
+		want    uint64
+		wantErr bool
+	}{
+		{in: "18446744073709551615", want: math.MaxUint64},
+		{in: "0xff", want: 255},
+		{in: "-0", want: 0},
+		{in: "-1", wantErr: true},
+		{in: "18446744073709551616", wantErr: true},
+	}
+	for _, input := range inputs {
+		got, err := (&ast.Value{Value: input.in}).AsUint64()
+		if (err != nil) != input.wantErr || got != input.want {
+			t.Errorf("AsUint64(%s) = %d, %v, want %d, err=%t", input.in, got, err, input.want, input.wantErr)
+		}
+	}
+}
+
+func TestAsFloat64(t *testing.T) {
+	inputs := []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{in: "1.5", want: 1.5},
+		{in: "-.5e-3", want: -.5e-3},
+		{in: "5.", want: 5},
+		{in: "2f", want: 2},
+		{in: "1.25F", want: 1.25},
+		{in: "0f", want: 0},
+		{in: "0.5", want: 0.5},
+		{in: "1E3", want: 1000},
+		{in: "42", want: 42},
+		{in: "017", want: 15},
+		{in: "0x10", want: 16},
+		{in: "inf", want: math.Inf(1)},
+		{in: "-Infinity", want: math.Inf(-1)},
+		{in: "1e999", want: math.Inf(1)},
+		{in: "abc", wantErr: true},
+		{in: "1_000", wantErr: true},
+		{in: "0x1p3", wantErr: true},
+		{in: "+1", wantErr: true},
+		{in: "1.5ff", wantErr: true},
+	}
+	for _, input := range inputs {
+		got, err := (&ast.Value{Value: input.in}).AsFloat64()
+		if (err != nil) != input.wantErr || got != input.want {
+			t.Errorf("AsFloat64(%s) = %v, %v, want %v, err=%t", input.in, got, err, input.want, input.wantErr)
+		}
+	}
+	for _, in := range []string{"nan", "-NaN"} {
+		if got, err := (&ast.Value{Value: in}).AsFloat64(); err != nil || !math.IsNaN(got) {
+			t.Errorf("AsFloat64(%s) = %v, %v, want NaN", in, got, err)
+		}
+	}
+}
+
+func TestAsBool(t *testing.T) {
+	for _, in := range []string{"true", "True", "t", "1"} {
+		if got, err := (&ast.Value{Value: in}).AsBool(); err != nil || !got {
+			t.Errorf("AsBool(%s) = %t, %v, want true", in, got, err)
+		}
+	}
+	for _, in := range []string{"false", "False", "f", "0"} {
+		if got, err := (&ast.Value{Value: in}).AsBool(); err != nil || got {
+			t.Errorf("AsBool(%s) = %t, %v, want false", in, got, err)
+		}
+	}
+	for _, in := range []string{"TRUE", "yes", "2", `"true"`} {
+		if got, err := (&ast.Value{Value: in}).AsBool(); err == nil {
+			t.Errorf("AsBool(%s) = %t, want error", in, got)
+		}
+	}
+}
+
+func TestAsString(t *testing.T) {
+	inputs := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: `"abc"`, want: "abc"},
+		{in: `'a"b'`, want: `a"b`},
+		{in: `"\101\x42\n"`, want: "AB\n"},
+		{in: `"\a\b\f\n\r\t\v\?\'\"\\"`, want: "\a\b\f\n\r\t\v?'\"\\"},
+		{in: `"\303\251"`, want: "\xc3\xa9"},
+		{in: `"\xff\X41"`, want: "\xffA"},
+		{in: `"caf\u00e9"`, want: "caf\u00e9"},
+		{in: `"\U0001F600"`, want: "\U0001F600"},
+		{in: `"\u00"`, wantErr: true},
+		{in: `"\u00g9"`, wantErr: true},
+		{in: `"\ud800"`, wantErr: true},
+		{in: `"\U00110000"`, wantErr: true},
+		{in: `"\18"`, wantErr: true},
+		{in: `abc`, wantErr: true},
+		{in: `"abc'`, wantErr: true},
+		{in: `"\q"`, wantErr: true},
+	}
+	for _, input := range inputs {
+		got, err := (&ast.Value{Value: input.in}).AsString()
+		if (err != nil) != input.wantErr || got != input.want {
+			t.Errorf("AsString(%s) = %q, %v, want %q, err=%t", input.in, got, err, input.want, input.wantErr)
+		}
+	}
+}
+
+func TestIsIdentifier(t *testing.T) {
+	inputs := map[string]bool{
+		"ENUM_VALUE": true,
+		"_x1":        true,
+		"inf":        true,
+		"1x":         false,
+		"-inf":       false,
+		`"s"`:        false,
+		"":           false,
+	}
+	for in, want := range inputs {
+		if got := (&ast.Value{Value: in}).IsIdentifier(); got != want {
+			t.Errorf("IsIdentifier(%q) = %t, want %t", in, got, want)
+		}
+	}
+}
+
+func TestValueConstructors(t *testing.T) {
+	inputs := []struct {
+		got  *ast.Value
+		want string
+	}{
+		{got: ast.IntValue(-42), want: "-42"},
+		{got: ast.UintValue(math.MaxUint64), want: "18446744073709551615"},
+		{got: ast.FloatValue(1.5), want: "1.5"},
+		{got: ast.FloatValue(1e21), want: "1e+21"},
+		{got: ast.FloatValue(3), want: "3"},
+		{got: ast.FloatValue(math.Inf(1)), want: "inf"},
+		{got: ast.FloatValue(math.Inf(-1)), want: "-inf"},
+		{got: ast.FloatValue(math.NaN()), want: "nan"},
+		{got: ast.BoolValue(true), want: "true"},
+		{got: ast.EnumValue("ENUM_VALUE"), want: "ENUM_VALUE"},
+		{got: ast.StringValue("a\"b"), want: `"a\"b"`},
+		{got: ast.BytesValue([]byte("a\x00\n\"\\\xff")), want: `"a\000\n\"\\\377"`},
+	}
+	for _, input := range inputs {
+		if input.got.Value != input.want {
+			t.Errorf("constructor returned %s, want %s", input.got.Value, input.want)
+		}
+	}
+	// The literals read back as the original values.
+	b := []byte{0, 1, 'a', 0x7f, 0x80, 0xff, '\'', '?'}
+	if got, err := ast.BytesValue(b).AsString(); err != nil || got != string(b) {
+		t.Errorf("BytesValue(%q).AsString() = %q, %v", b, got, err)
+	}
+	for _, f := range []float64{0.1, -1e-300, math.MaxFloat64} {
+		if got, err := ast.FloatValue(f).AsFloat64(); err != nil || got != f {
+			t.Errorf("FloatValue(%v).AsFloat64() = %v, %v", f, got, err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package ast
+
+// Cursor describes a node visited by Walk, and allows replacing or deleting it.
+type Cursor struct {
+	path    []*Node
+	node    *Node
+	deleted bool
+}
+
+// Node returns the visited node, or the node it was replaced with.
+func (c *Cursor) Node() *Node {
+	return c.node
+}
+
+// Path returns the ancestors of the visited node, starting with the top-level one. It is empty for
+// top-level nodes. The slice is only valid during the call to the visitor.
+func (c *Cursor) Path() []*Node {
+	return c.path
+}
+
+// Parent returns the node whose children include the visited node, or nil for top-level nodes.
+func (c *Cursor) Parent() *Node {
+	if len(c.path) == 0 {
+		return nil
+	}
+	return c.path[len(c.path)-1]
+}
+
+// Replace replaces the visited node with nd. When called before the children are visited, the
+// children of nd are visited instead.
+func (c *Cursor) Replace(nd *Node) {
+	c.node = nd
+	c.deleted = false
+}
+
+// Delete removes the visited node from its parent. When called before the children are visited,
+// they and After are skipped.
+func (c *Cursor) Delete() {
+	c.deleted = true
+}
+
+// Visitor is called by Walk for each node, before and after its children are visited.
+type Visitor interface {
+	// Before is called before the children of the node are visited. If it returns false, the
+	// children and After are skipped.
+	Before(c *Cursor) bool
+	// After is called after the children of the node were visited.
+	After(c *Cursor)
+}
+
+// VisitorFuncs is a Visitor calling the given functions, each of which may be nil.
+type VisitorFuncs struct {
+	BeforeFunc func(c *Cursor) bool
+	AfterFunc  func(c *Cursor)
+}
+
+// Before calls f.BeforeFunc if set, and returns true otherwise.
+func (f VisitorFuncs) Before(c *Cursor) bool {
+	if f.BeforeFunc == nil {
+		return true
+	}
+	return f.BeforeFunc(c)
+}
+
+// After calls f.AfterFunc if set.
+func (f VisitorFuncs) After(c *Cursor) {
+	if f.AfterFunc != nil {
+		f.AfterFunc(c)
+	}
+}
+
+// Walk traverses nodes and their descendants in depth-first order, including comment-only and
+// Deleted nodes, calling v.Before and v.After for each node. It returns the top-level nodes after
+// the replacements and deletions made by v; like append, the argument slice may be modified:
+//
+//	nodes = ast.Walk(nodes, v)
+//
+// The children of the ancestors of the visited node must only be modified through the Cursor.
+func Walk(nodes []*Node, v Visitor) []*Node {
+	w := &walker{v: v}
+	return w.walk(nodes)
+}
+
+// Inspect traverses nodes and their descendants in depth-first order, calling f with the ancestors
+// of each node, starting with the top-level one, and the node. If f returns false, the children of
+// the node are skipped. The path slice is only valid during the call to f.
+func Inspect(nodes []*Node, f func(path []*Node, n *Node) bool) {
+	Walk(nodes, VisitorFuncs{BeforeFunc: func(c *Cursor) bool {
+		return f(c.Path(), c.Node())
+	}})
+}
+
+type walker struct {
+	v    Visitor
+	path []*Node
+}
+
+// walk visits nodes, which have the same parent, and returns them after the replacements and
+// deletions. A new slice is only allocated if a node is deleted; empty children stay non-nil.
+func (w *walker) walk(nodes []*Node) []*Node {
+	var res []*Node
+	for i, nd := range nodes {
+		c := &Cursor{path: w.path, node: nd}
+		w.visit(c)
+		if c.deleted {
+			if res == nil {
+				res = append(make([]*Node, 0, len(nodes)-1), nodes[:i]...)
+			}
+			continue
+		}
+		if res != nil {
+			res = append(res, c.node)
+		} else {
+			nodes[i] = c.node
+		}
+	}
+	if res != nil {
+		return res
+	}
+	return nodes
+}
+
+func (w *walker) visit(c *Cursor) {
+	if !w.v.Before(c) || c.deleted {
+		return
+	}
+	if nd := c.node; len(nd.Children) > 0 {
+		w.path = append(w.path, nd)
+		nd.Children = w.walk(nd.Children)
+		w.path = w.path[:len(w.path)-1]
+	}
+	w.v.After(c)
+}
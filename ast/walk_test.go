@@ -0,0 +1,178 @@
+package ast_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kylelemons/godebug/diff"
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/parser"
+)
+
+const walkInput = `# Comment.
+a {
+  b: 1
+  c { d: 2 }
+}
+
+e: 3
+f {
+  g: 4
+}
+`
+
+func TestInspect(t *testing.T) {
+	nodes, err := parser.Parse([]byte(walkInput))
+	if err != nil {
+		t.Fatalf("Parse returned err %v", err)
+	}
+	var got []string
+	ast.Inspect(nodes, func(path []*ast.Node, n *ast.Node) bool {
+		var names []string
+		for _, p := range path {
+			names = append(names, p.Name)
+		}
+		got = append(got, strings.Join(append(names, n.Name), "."))
+		return n.Name != "f"
+	})
+	want := []string{"a", "a.b", "a.c", "a.c.d", "e", "f"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Inspect returned diff (-want, +got):\n%s", diff)
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	nodes, err := parser.Parse([]byte(walkInput))
+	if err != nil {
+		t.Fatalf("Parse returned err %v", err)
+	}
+	var got []string
+	ast.Walk(nodes, ast.VisitorFuncs{
+		BeforeFunc: func(c *ast.Cursor) bool {
+			got = append(got, "<"+c.Node().Name)
+			return c.Node().Name != "c"
+		},
+		AfterFunc: func(c *ast.Cursor) {
+			parent := "-"
+			if p := c.Parent(); p != nil {
+				parent = p.Name
+			}
+			got = append(got, c.Node().Name+"@"+parent+">")
+		},
+	})
+	want := []string{"<a", "<b", "b@a>", "<c", "a@->", "<e", "e@->", "<f", "<g", "g@f>", "f@->"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Walk returned diff (-want, +got):\n%s", diff)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	inputs := []struct {
+		name    string
+		visitor ast.Visitor
+		out     string
+	}{{
+		name: "rename",
+		visitor: ast.VisitorFuncs{BeforeFunc: func(c *ast.Cursor) bool {
+			if nd := c.Node(); len(c.Path()) > 0 && c.Path()[0].Name == "a" {
+				nd.Name = strings.ToUpper(nd.Name)
+			}
+			return true
+		}},
+		out: `# Comment.
+a {
+  B: 1
+  C { D: 2 }
+}
+
+e: 3
+f {
+  g: 4
+}
+`,
+	}, {
+		name: "replace before visits new children",
+		visitor: ast.VisitorFuncs{BeforeFunc: func(c *ast.Cursor) bool {
+			switch c.Node().Name {
+			case "c":
+				c.Replace(&ast.Node{Name: "x", SkipColon: true, Children: []*ast.Node{{Name: "d", Values: []*ast.Value{{Value: "5"}}}}})
+			case "d":
+				c.Replace(&ast.Node{Name: "y", Values: c.Node().Values})
+			}
+			return true
+		}},
+		out: `# Comment.
+a {
+  b: 1
+  x {
+    y: 5
+  }
+}
+
+e: 3
+f {
+  g: 4
+}
+`,
+	}, {
+		name: "replace after",
+		visitor: ast.VisitorFuncs{AfterFunc: func(c *ast.Cursor) {
+			if nd := c.Node(); nd.Name == "f" {
+				c.Replace(&ast.Node{PreComments: []string{"# Replaced."}, Name: "h", Values: nd.Children[0].Values})
+			}
+		}},
+		out: `# Comment.
+a {
+  b: 1
+  c { d: 2 }
+}
+
+e: 3
+# Replaced.
+h: 4
+`,
+	}, {
+		name: "delete removes only the node",
+		visitor: ast.VisitorFuncs{BeforeFunc: func(c *ast.Cursor) bool {
+			if c.Node().Name == "e" {
+				c.Delete()
+			}
+			return true
+		}},
+		out: `# Comment.
+a {
+  b: 1
+  c { d: 2 }
+}
+f {
+  g: 4
+}
+`,
+	}, {
+		name: "delete all children",
+		visitor: ast.VisitorFuncs{AfterFunc: func(c *ast.Cursor) {
+			if len(c.Path()) > 0 {
+				c.Delete()
+			}
+		}},
+		out: `# Comment.
+a {
+}
+
+e: 3
+f {
+}
+`,
+	}}
+	for _, input := range inputs {
+		nodes, err := parser.Parse([]byte(walkInput))
+		if err != nil {
+			t.Fatalf("Parse returned err %v", err)
+		}
+		nodes = ast.Walk(nodes, input.visitor)
+		if diff := diff.Diff(input.out, parser.Pretty(nodes, 0)); diff != "" {
+			t.Errorf("%s: Walk returned diff (-want, +got):\n%s", input.name, diff)
+		}
+	}
+}
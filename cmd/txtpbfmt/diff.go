@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/kylelemons/godebug/diff"
+)
+
+// diffContextLines is the number of unchanged lines shown around each change.
+const diffContextLines = 3
+
+type diffLine struct {
+	// op is one of ' ', '-' or '+'.
+	op   byte
+	text string
+	// Line numbers (1-based) of this line in the old and new content. For added
+	// lines oldLine is the number of the next old line, and vice versa.
+	oldLine, newLine int
+}
+
+// splitLines splits content into lines, keeping the trailing newline of each
+// line so that a missing newline at the end of the file shows up as a change.
+func splitLines(content []byte) []string {
+	var lines []string
+	for len(content) > 0 {
+		i := bytes.IndexByte(content, '\n')
+		if i < 0 {
+			lines = append(lines, string(content))
+			break
+		}
+		lines = append(lines, string(content[:i+1]))
+		content = content[i+1:]
+	}
+	return lines
+}
+
+// unifiedDiff returns a unified diff between content and newContent, or the
+// empty string if they are equal.
+func unifiedDiff(displayPath string, content, newContent []byte) string {
+	var lines []diffLine
+	oldLine, newLine := 1, 1
+	for _, c := range diff.DiffChunks(splitLines(content), splitLines(newContent)) {
+		for _, l := range c.Deleted {
+			lines = append(lines, diffLine{'-', l, oldLine, newLine})
+			oldLine++
+		}
+		for _, l := range c.Added {
+			lines = append(lines, diffLine{'+', l, oldLine, newLine})
+			newLine++
+		}
+		for _, l := range c.Equal {
+			lines = append(lines, diffLine{' ', l, oldLine, newLine})
+			oldLine++
+			newLine++
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(lines); {
+		for i < len(lines) && lines[i].op == ' ' {
+			i++
+		}
+		if i == len(lines) {
+			break
+		}
+		start := i - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		// Extend the hunk over following changes separated by at most twice the
+		// context, so that their contexts would overlap.
+		end := i
+		for {
+			for end < len(lines) && lines[end].op != ' ' {
+				end++
+			}
+			next := end
+			for next < len(lines) && lines[next].op == ' ' {
+				next++
+			}
+			if next == len(lines) || next-end > 2*diffContextLines {
+				end += diffContextLines
+				if end > len(lines) {
+					end = len(lines)
+				}
+				break
+			}
+			end = next
+		}
+		if b.Len() == 0 {
+			fmt.Fprintf(&b, "--- %s.orig\n+++ %s\n", displayPath, displayPath)
+		}
+		writeHunk(&b, lines[start:end])
+		i = end
+	}
+	return b.String()
+}
+
+func writeHunk(b *strings.Builder, hunk []diffLine) {
+	oldCount, newCount := 0, 0
+	for _, l := range hunk {
+		if l.op != '+' {
+			oldCount++
+		}
+		if l.op != '-' {
+			newCount++
+		}
+	}
+	oldStart, newStart := hunk[0].oldLine, hunk[0].newLine
+	// An empty range starts at the line before the hunk, as in GNU diff.
+	if oldCount == 0 {
+		oldStart--
+	}
+	if newCount == 0 {
+		newStart--
+	}
+	fmt.Fprintf(b, "@@ -%s +%s @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+	for _, l := range hunk {
+		b.WriteByte(l.op)
+		b.WriteString(l.text)
+		if !strings.HasSuffix(l.text, "\n") {
+			b.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/kylelemons/godebug/diff"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	inputs := []struct {
+		name       string
+		content    string
+		newContent string
+		want       string
+	}{{
+		name:       "no change",
+		content:    "a: 1\n",
+		newContent: "a: 1\n",
+		want:       "",
+	}, {
+		name:       "single line",
+		content:    "a:1\n",
+		newContent: "a: 1\n",
+		want: `--- p.orig
++++ p
+@@ -1 +1 @@
+-a:1
++a: 1
+`,
+	}, {
+		name:       "missing newline at end of file",
+		content:    "a: 1",
+		newContent: "a: 1\n",
+		want: `--- p.orig
++++ p
+@@ -1 +1 @@
+-a: 1
+\ No newline at end of file
++a: 1
+`,
+	}, {
+		name:       "separate hunks",
+		content:    "a:1\nb: 2\nc: 3\nd: 4\ne: 5\nf: 6\ng: 7\nh: 8\ni:9\n",
+		newContent: "a: 1\nb: 2\nc: 3\nd: 4\ne: 5\nf: 6\ng: 7\nh: 8\ni: 9\n",
+		want: `--- p.orig
++++ p
+@@ -1,4 +1,4 @@
+-a:1
++a: 1
+ b: 2
+ c: 3
+ d: 4
+@@ -6,4 +6,4 @@
+ f: 6
+ g: 7
+ h: 8
+-i:9
++i: 9
+`,
+	}, {
+		name:       "merged hunks",
+		content:    "a:1\nb: 2\nc: 3\nd: 4\ne: 5\nf: 6\ng:7\n",
+		newContent: "a: 1\nb: 2\nc: 3\nd: 4\ne: 5\nf: 6\ng: 7\n",
+		want: `--- p.orig
++++ p
+@@ -1,7 +1,7 @@
+-a:1
++a: 1
+ b: 2
+ c: 3
+ d: 4
+ e: 5
+ f: 6
+-g:7
++g: 7
+`,
+	}, {
+		name:       "deleted lines",
+		content:    "a: 1\n\n\nb: 2\n",
+		newContent: "a: 1\n\nb: 2\n",
+		want:       "--- p.orig\n+++ p\n@@ -1,4 +1,3 @@\n a: 1\n \n-\n b: 2\n",
+	}}
+	for _, input := range inputs {
+		got := unifiedDiff("p", []byte(input.content), []byte(input.newContent))
+		if d := diff.Diff(input.want, got); d != "" {
+			t.Errorf("unifiedDiff[%s] returned diff (-want, +got):\n%s", input.name, d)
+		}
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
 
 	"flag"
@@ -21,13 +23,23 @@ import (
 var (
 	// Top level flags.
 	dryRun                                 = flag.Bool("dry_run", false, "Enable dry run mode.")
+	list                                   = flag.Bool("l", false, "List files whose formatting differs from txtpbfmt's. Files are not modified.")
+	showDiff                               = flag.Bool("d", false, "Display diffs instead of rewriting files.")
+	check                                  = flag.Bool("check", false, "Exit with status 3 if any file's formatting differs from txtpbfmt's. Files are not modified.")
 	expandAllChildren                      = flag.Bool("expand_all_children", false, "Expand all children irrespective of initial state.")
 	skipAllColons                          = flag.Bool("skip_all_colons", false, "Skip colons whenever possible.")
+	colonsBeforeMessages                   = flag.Bool("colons_before_messages", false, "Write a colon before all messages and lists of messages. (--skip_all_colons takes precedence.)")
+	colonsBeforeScalars                    = flag.Bool("colons_before_scalars", false, "Write a colon before all scalar values and lists of values.")
 	sortFieldsByFieldName                  = flag.Bool("sort_fields_by_field_name", false, "Sort fields by field name.")
 	sortRepeatedFieldsByContent            = flag.Bool("sort_repeated_fields_by_content", false, "Sort adjacent scalar fields of the same field name by their contents.")
 	sortRepeatedFieldsBySubfield           = flag.String("sort_repeated_fields_by_subfield", "", "Sort adjacent message fields of the given field name by the contents of the given subfield.")
+	requireFieldSortOrder                  = flag.Bool("require_field_sort_order_to_match_all_fields_in_node", false, "Fail if a node with a --field_order has fields that are not listed in it.")
 	removeDuplicateValuesForRepeatedFields = flag.Bool("remove_duplicate_values_for_repeated_fields", false, "Remove lines that have the same field name and scalar value as another.")
 	allowTripleQuotedStrings               = flag.Bool("allow_triple_quoted_strings", false, `Allow Python-style """ or ''' delimited strings in input.`)
+	extensions                             = flag.String("extensions", ".textproto,.txtpb,.pbtxt,.asciipb", "Comma-separated list of file extensions formatted when walking directories.")
+	exclude                                = flag.String("exclude", "", "Comma-separated list of glob patterns for files and directories to skip when walking directories. A pattern matches either the base name or the full path.")
+	configFiles                            = flag.Bool("config_files", true, "Apply the settings of "+parser.ConfigFileName+" files found in the directory of each file and its parents. Flags given on the command line take precedence.")
+	jobs                                   = flag.Int("jobs", runtime.NumCPU(), "Number of files formatted concurrently.")
 	stdinDisplayPath                       = flag.String("stdin_display_path", "<stdin>", "The path to display when referring to the content read from stdin.")
 	wrapStringsAtColumn                    = flag.Int("wrap_strings_at_column", 0, "Max columns for string field values. (0 means no wrap.)")
 	wrapHTMLStrings                        = flag.Bool("wrap_html_strings", false, "Wrap strings containing HTML tags. (Requires wrap_strings_at_column > 0.)")
@@ -35,10 +47,111 @@ var (
 	wrapStringsWithoutWordwrap             = flag.Bool("wrap_strings_without_wordwrap", false, "Wrap strings at the given column only.")
 	preserveAngleBrackets                  = flag.Bool("preserve_angle_brackets", false, "Preserve angle brackets instead of converting to curly braces.")
 	smartQuotes                            = flag.Bool("smart_quotes", false, "Use single quotes around strings that contain double but not single quotes.")
+	indentWidth                            = flag.Int("indent_width", config.DefaultIndentWidth, "Number of spaces for each level of indentation. With --use_tabs, the width of a tab when wrapping strings.")
+	useTabs                                = flag.Bool("use_tabs", false, "Indent with tabs instead of spaces.")
+	alignValues                            = flag.Bool("align_values", false, "Align the values of adjacent scalar fields.")
+	alignComments                          = flag.Bool("align_comments", false, "Align the inline comments of adjacent one-line fields.")
+	removeComments                         = flag.Bool("remove_comments", false, "Remove all comments and blank lines.")
+	maxLineWidth                           = flag.Int("max_line_width", 0, "Write messages and lists without comments on one line if they fit within this width, and expand them otherwise. (0 means keep the input layout.)")
 )
 
+var (
+	fieldOrder fieldOrderList
+	lines      lineRange
+	separators separatorStyle
+	canonical  canonicalStyle
+)
+
+func init() {
+	flag.Var(&lines, "lines", `Only format the nodes overlapping the given range of lines, as "<start>:<end>" (1-based, inclusive). Requires a single file.`)
+	flag.Var(&separators, "separators", `Separators between the fields of messages written on one line: "remove", "preserve", "comma" or "semicolon".`)
+	flag.Var(&canonical, "canonical", `Print in the layout of a protobuf TextFormat printer: "cpp" or "go".`)
+	flag.Var(&fieldOrder, "field_order", `Order of the fields within nodes of the given name, as "<node name>:<field>,<field>,...". Use "`+config.RootName+`" as the node name for top-level fields. May be repeated.`)
+}
+
+// fieldOrderList is a flag.Value collecting the values of the repeated --field_order flag.
+type fieldOrderList []string
+
+func (l *fieldOrderList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *fieldOrderList) Set(s string) error {
+	if _, _, err := config.ParseFieldSortOrder(s); err != nil {
+		return err
+	}
+	*l = append(*l, s)
+	return nil
+}
+
+// separatorStyle is a flag.Value holding the style given by --separators.
+type separatorStyle config.SeparatorStyle
+
+func (s *separatorStyle) String() string {
+	return string(*s)
+}
+
+func (s *separatorStyle) Set(name string) error {
+	style, err := config.ParseSeparatorStyle(name)
+	if err != nil {
+		return err
+	}
+	*s = separatorStyle(style)
+	return nil
+}
+
+// canonicalStyle is a flag.Value holding the style given by --canonical.
+type canonicalStyle config.CanonicalStyle
+
+func (s *canonicalStyle) String() string {
+	return string(*s)
+}
+
+func (s *canonicalStyle) Set(name string) error {
+	style, err := config.ParseCanonicalStyle(name)
+	if err != nil {
+		return err
+	}
+	*s = canonicalStyle(style)
+	return nil
+}
+
+// lineRange is a flag.Value holding the range of lines given by --lines.
+type lineRange struct {
+	start, end int
+}
+
+func (r *lineRange) String() string {
+	if *r == (lineRange{}) {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", r.start, r.end)
+}
+
+func (r *lineRange) Set(s string) error {
+	start, end, ok := strings.Cut(s, ":")
+	if !ok {
+		return fmt.Errorf("want <start>:<end>, got %q", s)
+	}
+	var err error
+	if r.start, err = strconv.Atoi(start); err != nil {
+		return err
+	}
+	if r.end, err = strconv.Atoi(end); err != nil {
+		return err
+	}
+	if r.start < 1 || r.end < r.start {
+		return fmt.Errorf("invalid range of lines %q", s)
+	}
+	return nil
+}
+
 const stdinPlaceholderPath = "<stdin>"
 
+// exitCodeNeedsFormatting is the exit status used by --check when at least one
+// file would be changed by formatting. Other failures exit with status 1.
+const exitCodeNeedsFormatting = 3
+
 func read(path string) ([]byte, error) {
 	if path == stdinPlaceholderPath {
 		return io.ReadAll(bufio.NewReader(os.Stdin))
@@ -58,7 +171,76 @@ func contentForLogging(content []byte) string {
 	return res
 }
 
-func processPath(path string) error {
+// flagSetters copy the value of each formatting flag into the configuration.
+var flagSetters = map[string]func(c *config.Config){
+	"expand_all_children":             func(c *config.Config) { c.ExpandAllChildren = *expandAllChildren },
+	"skip_all_colons":                 func(c *config.Config) { c.SkipAllColons = *skipAllColons },
+	"colons_before_messages":          func(c *config.Config) { c.ColonsBeforeMessages = *colonsBeforeMessages },
+	"colons_before_scalars":           func(c *config.Config) { c.ColonsBeforeScalars = *colonsBeforeScalars },
+	"separators":                      func(c *config.Config) { c.Separators = config.SeparatorStyle(separators) },
+	"sort_fields_by_field_name":       func(c *config.Config) { c.SortFieldsByFieldName = *sortFieldsByFieldName },
+	"sort_repeated_fields_by_content": func(c *config.Config) { c.SortRepeatedFieldsByContent = *sortRepeatedFieldsByContent },
+	"sort_repeated_fields_by_subfield": func(c *config.Config) {
+		c.SortRepeatedFieldsBySubfield = strings.Split(*sortRepeatedFieldsBySubfield, ",")
+	},
+	"field_order": func(c *config.Config) {
+		for _, spec := range fieldOrder {
+			// Already validated by fieldOrderList.Set.
+			nodeName, order, _ := config.ParseFieldSortOrder(spec)
+			c.AddFieldSortOrder(nodeName, order...)
+		}
+	},
+	"require_field_sort_order_to_match_all_fields_in_node": func(c *config.Config) { c.RequireFieldSortOrderToMatchAllFieldsInNode = *requireFieldSortOrder },
+	"remove_duplicate_values_for_repeated_fields": func(c *config.Config) {
+		c.RemoveDuplicateValuesForRepeatedFields = *removeDuplicateValuesForRepeatedFields
+	},
+	"allow_triple_quoted_strings":   func(c *config.Config) { c.AllowTripleQuotedStrings = *allowTripleQuotedStrings },
+	"wrap_strings_at_column":        func(c *config.Config) { c.WrapStringsAtColumn = *wrapStringsAtColumn },
+	"wrap_html_strings":             func(c *config.Config) { c.WrapHTMLStrings = *wrapHTMLStrings },
+	"wrap_strings_after_newlines":   func(c *config.Config) { c.WrapStringsAfterNewlines = *wrapStringsAfterNewlines },
+	"wrap_strings_without_wordwrap": func(c *config.Config) { c.WrapStringsWithoutWordwrap = *wrapStringsWithoutWordwrap },
+	"preserve_angle_brackets":       func(c *config.Config) { c.PreserveAngleBrackets = *preserveAngleBrackets },
+	"smart_quotes":                  func(c *config.Config) { c.SmartQuotes = *smartQuotes },
+	"indent_width":                  func(c *config.Config) { c.IndentWidth = *indentWidth },
+	"use_tabs":                      func(c *config.Config) { c.UseTabs = *useTabs },
+	"max_line_width":                func(c *config.Config) { c.MaxLineWidth = *maxLineWidth },
+	"align_values":                  func(c *config.Config) { c.AlignValues = *alignValues },
+	"align_comments":                func(c *config.Config) { c.AlignComments = *alignComments },
+	"canonical":                     func(c *config.Config) { c.Canonical = config.CanonicalStyle(canonical) },
+	"remove_comments":               func(c *config.Config) { c.RemoveComments = *removeComments },
+}
+
+// newConfig returns the configuration for the file at path. Without config files this is the
+// configuration given by the flags. Otherwise the settings of the config files are applied first,
+// and only the flags that were explicitly set override them.
+func newConfig(path string) (config.Config, error) {
+	if !*configFiles {
+		return flagConfig(), nil
+	}
+	var c config.Config
+	if err := parser.AddConfigFilesToConfig(path, &c); err != nil {
+		return c, err
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if set, ok := flagSetters[f.Name]; ok {
+			set(&c)
+		}
+	})
+	return c, nil
+}
+
+// flagConfig returns the configuration given by the flags alone.
+func flagConfig() config.Config {
+	var c config.Config
+	for _, set := range flagSetters {
+		set(&c)
+	}
+	return c
+}
+
+// processPath formats the given path and reports whether the formatted content
+// differs from the original. Anything to be printed to stdout is written to out.
+func processPath(path string, out io.Writer) (bool, error) {
 	if strings.HasPrefix(path, "//depot/google3/") {
 		path = strings.Replace(path, "//depot/google3/", "", 1)
 	}
@@ -71,12 +253,8 @@ func processPath(path string) error {
 	}
 
 	content, err := read(path)
-	if os.IsNotExist(err) {
-		log.Error("Ignoring path: ", err)
-		return fmt.Errorf("path not found")
-	}
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	// Only pass the verbose logger if its level is enabled.
@@ -84,68 +262,158 @@ func processPath(path string) error {
 	if l := log.V(2); l {
 		logger = l
 	}
-	newContent, err := parser.FormatWithConfig(content, config.Config{
-		ExpandAllChildren:                      *expandAllChildren,
-		SkipAllColons:                          *skipAllColons,
-		SortFieldsByFieldName:                  *sortFieldsByFieldName,
-		SortRepeatedFieldsByContent:            *sortRepeatedFieldsByContent,
-		SortRepeatedFieldsBySubfield:           strings.Split(*sortRepeatedFieldsBySubfield, ","),
-		RemoveDuplicateValuesForRepeatedFields: *removeDuplicateValuesForRepeatedFields,
-		AllowTripleQuotedStrings:               *allowTripleQuotedStrings,
-		WrapStringsAtColumn:                    *wrapStringsAtColumn,
-		WrapHTMLStrings:                        *wrapHTMLStrings,
-		WrapStringsAfterNewlines:               *wrapStringsAfterNewlines,
-		WrapStringsWithoutWordwrap:             *wrapStringsWithoutWordwrap,
-		PreserveAngleBrackets:                  *preserveAngleBrackets,
-		SmartQuotes:                            *smartQuotes,
-		Logger:                                 logger,
-	})
+	c, err := newConfig(displayPath)
+	if err != nil {
+		return false, err
+	}
+	c.Logger = logger
+	var newContent []byte
+	if lines != (lineRange{}) {
+		newContent, err = parser.FormatRange(content, lines.start, lines.end, c)
+	} else {
+		newContent, err = parser.FormatWithConfig(content, c)
+	}
 	if err != nil {
-		errorf("parser.Format for path %v with content %q returned err %v", displayPath, contentForLogging(content), err)
-		return fmt.Errorf("parser.Format failed")
+		return false, fmt.Errorf("parser.Format for path %v with content %q returned err %v", displayPath, contentForLogging(content), err)
 	}
 	log.V(2).Infof("New content for path %s: %q", displayPath, newContent)
 
-	return write(path, content, newContent)
+	return write(path, displayPath, content, newContent, out)
 }
 
-func write(path string, content, newContent []byte) error {
+// write outputs newContent according to the mode selected by flags and
+// reports whether it differs from content.
+func write(path, displayPath string, content, newContent []byte, out io.Writer) (bool, error) {
+	changed := !bytes.Equal(content, newContent)
+	if *list || *check || *showDiff {
+		// None of these modes touch the files or print the formatted content.
+		if changed && *list {
+			fmt.Fprintln(out, displayPath)
+		}
+		if changed && *showDiff {
+			io.WriteString(out, unifiedDiff(displayPath, content, newContent))
+		}
+		if !changed {
+			log.Info("No change for path ", path)
+		}
+		return changed, nil
+	}
 	if path == stdinPlaceholderPath {
-		fmt.Print(string(newContent))
-		return nil
+		out.Write(newContent)
+		return changed, nil
 	}
-	if bytes.Equal(content, newContent) {
+	if !changed {
 		log.Info("No change for path ", path)
-		return nil
+		return false, nil
 	}
 	if *dryRun {
-		fmt.Println(string(newContent))
-		return nil
+		fmt.Fprintln(out, string(newContent))
+		return true, nil
 	}
 	if err := os.WriteFile(path, newContent, 0664); err != nil {
-		return err
+		return true, err
 	}
-	return nil
+	return true, nil
 }
 
 func main() {
 	flag.Parse()
-	paths := flag.Args()
-	if len(paths) == 0 {
+	if flag.Arg(0) == "lsp" {
+		// Allow flags after the subcommand too.
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if flag.NArg() > 0 {
+			log.Exit("txtpbfmt lsp takes no arguments, got ", flag.Args())
+		}
+		if err := serveLSP(os.Stdin, os.Stdout, lspConfig); err != nil {
+			log.Exit(err)
+		}
+		return
+	}
+	if flag.Arg(0) == "diff" {
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if flag.NArg() != 2 {
+			log.Exit("txtpbfmt diff takes two files, got ", flag.Args())
+		}
+		c, err := newConfig(flag.Arg(1))
+		if err != nil {
+			log.Exit(err)
+		}
+		if err := diffFiles(flag.Arg(0), flag.Arg(1), c, os.Stdout); err != nil {
+			log.Exit(err)
+		}
+		return
+	}
+	if flag.Arg(0) == "merge" {
+		flag.CommandLine.Parse(flag.Args()[1:])
+		if flag.NArg() != 3 {
+			log.Exit("txtpbfmt merge takes three files, got ", flag.Args())
+		}
+		c, err := newConfig(flag.Arg(1))
+		if err != nil {
+			log.Exit(err)
+		}
+		content, conflicts, err := mergeFiles(flag.Arg(0), flag.Arg(1), flag.Arg(2), c)
+		if err != nil {
+			log.Exit(err)
+		}
+		if *dryRun {
+			os.Stdout.Write(content)
+		} else if err := os.WriteFile(flag.Arg(1), content, 0664); err != nil {
+			log.Exit(err)
+		}
+		if conflicts > 0 {
+			errorf("%s: %d conflict(s)", flag.Arg(1), conflicts)
+			log.Flush()
+			os.Exit(exitCodeConflicts)
+		}
+		return
+	}
+	paths, err := expandPaths(flag.Args(), walkOptions{
+		extensions: splitList(*extensions),
+		exclude:    splitList(*exclude),
+	})
+	if err != nil {
+		log.Exit(err)
+	}
+	if len(flag.Args()) == 0 {
 		paths = append(paths, stdinPlaceholderPath)
 	}
+	if lines != (lineRange{}) && len(paths) > 1 {
+		log.Exit("--lines requires a single file, got ", len(paths))
+	}
 	log.Info("paths: ", paths)
+	if status := formatPaths(paths); status != 0 {
+		log.Flush()
+		os.Exit(status)
+	}
+}
+
+// formatPaths formats the given paths according to the flags and returns the
+// exit status.
+func formatPaths(paths []string) int {
 	errs := 0
-	for _, path := range paths {
-		if err := processPath(path); err != nil {
-			if err.Error() == "path not found" || err.Error() == "parser.Format failed" {
-				errs++
-				continue
-			}
-			log.Exit(err)
+	changed := 0
+	processAll(paths, *jobs, func(path string) result {
+		var out bytes.Buffer
+		c, err := processPath(path, &out)
+		return result{changed: c, out: out.Bytes(), err: err}
+	}, func(path string, r result) {
+		os.Stdout.Write(r.out)
+		if r.err != nil {
+			errorf("%v", r.err)
+			errs++
 		}
-	}
+		if r.changed {
+			changed++
+		}
+	})
 	if errs > 0 {
-		log.Exit(errs, " error(s) encountered during execution")
+		log.Error(errs, " error(s) encountered during execution")
+		return 1
+	}
+	if *check && changed > 0 {
+		log.Info(changed, " file(s) need formatting")
+		return exitCodeNeedsFormatting
 	}
+	return 0
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kylelemons/godebug/diff"
+)
+
+func TestFormatPathsListAndCheck(t *testing.T) {
+	defer func(l, c bool) { *list, *check = l, c }(*list, *check)
+	inputs := []struct {
+		name       string
+		content    string
+		list       bool
+		check      bool
+		wantOut    bool // Whether the path is listed.
+		wantStatus int
+	}{{
+		name:    "formatted, list",
+		content: "a: 1\n",
+		list:    true,
+	}, {
+		name:    "formatted, check",
+		content: "a: 1\n",
+		check:   true,
+	}, {
+		name:    "needs formatting, list",
+		content: "a:1\n",
+		list:    true,
+		wantOut: true,
+	}, {
+		name:       "needs formatting, check",
+		content:    "a:1\n",
+		check:      true,
+		wantStatus: exitCodeNeedsFormatting,
+	}, {
+		name:       "needs formatting, list and check",
+		content:    "a:1\n",
+		list:       true,
+		check:      true,
+		wantOut:    true,
+		wantStatus: exitCodeNeedsFormatting,
+	}, {
+		name:       "parse failure, list",
+		content:    "a: \"b\n",
+		list:       true,
+		wantStatus: 1,
+	}, {
+		name:       "parse failure, check",
+		content:    "a: \"b\n",
+		check:      true,
+		wantStatus: 1,
+	}}
+	for _, input := range inputs {
+		path := filepath.Join(t.TempDir(), "a.textproto")
+		if err := os.WriteFile(path, []byte(input.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		*list, *check = input.list, input.check
+		var got int
+		out := captureStdout(t, func() { got = formatPaths([]string{path}) })
+		if got != input.wantStatus {
+			t.Errorf("formatPaths[%s] returned status %d, want %d", input.name, got, input.wantStatus)
+		}
+		want := ""
+		if input.wantOut {
+			want = path + "\n"
+		}
+		if d := diff.Diff(want, out); d != "" {
+			t.Errorf("formatPaths[%s] returned output diff (-want, +got):\n%s", input.name, d)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != input.content {
+			t.Errorf("formatPaths[%s] modified the file: got %q, want %q", input.name, content, input.content)
+		}
+	}
+}
+
+// captureStdout returns what f writes to os.Stdout.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	tmp, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tmp.Close()
+	defer func(stdout *os.File) { os.Stdout = stdout }(os.Stdout)
+	os.Stdout = tmp
+	f()
+	out, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/kylelemons/godebug/diff"
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/config"
+	"github.com/protocolbuffers/txtpbfmt/parser"
+)
+
+// JSON-RPC error codes used by the language server.
+const (
+	lspMethodNotFound = -32601
+	lspInvalidParams  = -32602
+	lspRequestFailed  = -32803
+)
+
+// LSP enum values used by the language server.
+const (
+	lspSyncFull               = 1
+	lspSeverityError          = 1
+	lspSymbolKindField        = 8
+	lspSymbolKindStruct       = 23
+	lspFoldingRangeKindRegion = "region"
+)
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *lspError) Error() string {
+	return e.Message
+}
+
+// lspMessage is a JSON-RPC request, response or notification.
+type lspMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	// Result is always present in successful responses, even if null.
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *lspError       `json:"error,omitempty"`
+}
+
+// lspPosition is a zero-based line and a character offset in UTF-16 code units.
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Code     string   `json:"code,omitempty"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspDocumentSymbol struct {
+	Name           string              `json:"name"`
+	Detail         string              `json:"detail,omitempty"`
+	Kind           int                 `json:"kind"`
+	Range          lspRange            `json:"range"`
+	SelectionRange lspRange            `json:"selectionRange"`
+	Children       []lspDocumentSymbol `json:"children,omitempty"`
+}
+
+type lspFoldingRange struct {
+	StartLine int    `json:"startLine"`
+	EndLine   int    `json:"endLine"`
+	Kind      string `json:"kind,omitempty"`
+}
+
+type lspTextDocumentParams struct {
+	TextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+	// ContentChanges is only set for didChange. The server requests full document sync, so the
+	// last change holds the whole new content.
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+	// Range is only set for rangeFormatting.
+	Range lspRange `json:"range"`
+}
+
+// lspDocument is the content of an open document.
+type lspDocument struct {
+	content []byte
+	// lineStarts holds the byte offset of the start of each line.
+	lineStarts []int
+}
+
+func newLSPDocument(content []byte) *lspDocument {
+	d := &lspDocument{content: content, lineStarts: []int{0}}
+	for i, c := range content {
+		if c == '\n' {
+			d.lineStarts = append(d.lineStarts, i+1)
+		}
+	}
+	return d
+}
+
+// position converts a byte offset into an LSP position.
+func (d *lspDocument) position(offset int) lspPosition {
+	if offset > len(d.content) {
+		offset = len(d.content)
+	}
+	line := sort.SearchInts(d.lineStarts, offset+1) - 1
+	character := 0
+	for _, r := range string(d.content[d.lineStarts[line]:offset]) {
+		if r >= 0x10000 {
+			// Encoded as a surrogate pair in UTF-16.
+			character++
+		}
+		character++
+	}
+	return lspPosition{Line: line, Character: character}
+}
+
+// lineEnd returns the byte offset of the end of the line containing offset, before the newline.
+func (d *lspDocument) lineEnd(offset int) int {
+	if i := bytes.IndexByte(d.content[offset:], '\n'); i >= 0 {
+		return offset + i
+	}
+	return len(d.content)
+}
+
+func (d *lspDocument) rangeOf(start, end int) lspRange {
+	return lspRange{Start: d.position(start), End: d.position(end)}
+}
+
+// lspServer is a Language Server Protocol server for textproto files. It offers formatting,
+// diagnostics, document symbols and folding ranges.
+type lspServer struct {
+	in  *bufio.Reader
+	out io.Writer
+	// config returns the configuration for the file at path, or for a file that isn't on disk if
+	// path is empty. The MetaComments of the document are added to it.
+	config   func(path string) (config.Config, error)
+	docs     map[string]*lspDocument
+	shutdown bool
+}
+
+// serveLSP runs a language server reading requests from r and writing responses to w, until the
+// client sends the exit notification or closes r.
+func serveLSP(r io.Reader, w io.Writer, config func(path string) (config.Config, error)) error {
+	s := &lspServer{
+		in:     bufio.NewReader(r),
+		out:    w,
+		config: config,
+		docs:   map[string]*lspDocument{},
+	}
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit notification received before shutdown request")
+			}
+			return nil
+		}
+		result, err := s.handle(msg)
+		if msg.ID == nil {
+			// Notifications have no response.
+			if err != nil {
+				log.Errorf("Error handling %s notification: %v", msg.Method, err)
+			}
+			continue
+		}
+		resp := &lspMessage{JSONRPC: "2.0", ID: msg.ID}
+		if err != nil {
+			var le *lspError
+			if !errors.As(err, &le) {
+				le = &lspError{Code: lspRequestFailed, Message: err.Error()}
+			}
+			resp.Error = le
+		} else if resp.Result, err = json.Marshal(result); err != nil {
+			return err
+		}
+		if err := s.write(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// read reads the next message, preceded by its headers.
+func (s *lspServer) read() (*lspMessage, error) {
+	length := -1
+	for {
+		line, err := s.in.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line != "" {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, val, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(val)); err != nil {
+				return nil, fmt.Errorf("invalid Content-Length header %q: %v", line, err)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("missing Content-Length header")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in, body); err != nil {
+		return nil, err
+	}
+	msg := &lspMessage{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, fmt.Errorf("invalid message %q: %v", body, err)
+	}
+	return msg, nil
+}
+
+func (s *lspServer) write(msg *lspMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = s.out.Write(body)
+	return err
+}
+
+func (s *lspServer) notify(method string, params any) error {
+	p, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.write(&lspMessage{JSONRPC: "2.0", Method: method, Params: p})
+}
+
+// handle handles a request or notification and returns the result for requests.
+func (s *lspServer) handle(msg *lspMessage) (any, error) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":                lspSyncFull,
+				"documentFormattingProvider":      true,
+				"documentRangeFormattingProvider": true,
+				"documentSymbolProvider":          true,
+				"foldingRangeProvider":            true,
+			},
+			"serverInfo": map[string]any{"name": "txtpbfmt"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	}
+	if !strings.HasPrefix(msg.Method, "textDocument/") {
+		if msg.ID != nil {
+			return nil, &lspError{Code: lspMethodNotFound, Message: "method not supported: " + msg.Method}
+		}
+		// Ignore other notifications, e.g. "initialized" and "$/cancelRequest".
+		return nil, nil
+	}
+	var params lspTextDocumentParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return nil, &lspError{Code: lspInvalidParams, Message: err.Error()}
+	}
+	uri := params.TextDocument.URI
+	switch msg.Method {
+	case "textDocument/didOpen":
+		return nil, s.update(uri, []byte(params.TextDocument.Text))
+	case "textDocument/didChange":
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		return nil, s.update(uri, []byte(params.ContentChanges[len(params.ContentChanges)-1].Text))
+	case "textDocument/didClose":
+		delete(s.docs, uri)
+		return nil, s.publishDiagnostics(uri, []lspDiagnostic{})
+	}
+	d, ok := s.docs[uri]
+	if !ok {
+		if msg.ID == nil {
+			return nil, nil
+		}
+		return nil, &lspError{Code: lspInvalidParams, Message: "document is not open: " + uri}
+	}
+	switch msg.Method {
+	case "textDocument/formatting":
+		return s.format(uri, d, func(c config.Config) ([]byte, error) {
+			return parser.FormatWithConfig(d.content, c)
+		})
+	case "textDocument/rangeFormatting":
+		endLine := params.Range.End.Line
+		if params.Range.End.Character == 0 && endLine > params.Range.Start.Line {
+			// The range ends at the start of a line, so it doesn't include that line.
+			endLine--
+		}
+		return s.format(uri, d, func(c config.Config) ([]byte, error) {
+			// LSP lines are zero-based.
+			return parser.FormatRange(d.content, params.Range.Start.Line+1, endLine+1, c)
+		})
+	case "textDocument/documentSymbol":
+		nodes, _, err := s.parse(uri, d)
+		if err != nil {
+			return nil, err
+		}
+		return documentSymbols(d, nodes), nil
+	case "textDocument/foldingRange":
+		nodes, _, err := s.parse(uri, d)
+		if err != nil {
+			return nil, err
+		}
+		return foldingRanges(d, nodes), nil
+	}
+	if msg.ID != nil {
+		return nil, &lspError{Code: lspMethodNotFound, Message: "method not supported: " + msg.Method}
+	}
+	return nil, nil
+}
+
+// uriPath returns the file path of a "file" URI, or the empty string for other URIs.
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func (s *lspServer) update(uri string, content []byte) error {
+	d := newLSPDocument(content)
+	s.docs[uri] = d
+	_, diagnostics, err := s.parse(uri, d)
+	if err != nil {
+		diagnostics = []lspDiagnostic{{
+			Range:    d.rangeOf(0, 0),
+			Severity: lspSeverityError,
+			Source:   "txtpbfmt",
+			Message:  err.Error(),
+		}}
+	}
+	return s.publishDiagnostics(uri, diagnostics)
+}
+
+func (s *lspServer) publishDiagnostics(uri string, diagnostics []lspDiagnostic) error {
+	return s.notify("textDocument/publishDiagnostics", map[string]any{
+		"uri":         uri,
+		"diagnostics": diagnostics,
+	})
+}
+
+// parse parses the document, recovering from syntax errors, and returns the resulting nodes along
+// with diagnostics for the syntax errors. It returns an error if the document can't be parsed at
+// all, e.g. because of an invalid MetaComment.
+func (s *lspServer) parse(uri string, d *lspDocument) ([]*ast.Node, []lspDiagnostic, error) {
+	c, err := s.config(uriPath(uri))
+	if err != nil {
+		return nil, nil, err
+	}
+	diagnostics := []lspDiagnostic{}
+	nodes, err := parser.ParseWithRecovery(d.content, c)
+	var pes parser.ParseErrors
+	if errors.As(err, &pes) {
+		for _, pe := range pes {
+			start := int(pe.Pos.Byte)
+			diagnostics = append(diagnostics, lspDiagnostic{
+				Range:    d.rangeOf(start, d.lineEnd(start)),
+				Severity: lspSeverityError,
+				Code:     pe.Code.String(),
+				Source:   "txtpbfmt",
+				Message:  pe.Msg,
+			})
+		}
+		return nodes, diagnostics, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	// Errors detected by sorting, which ParseWithRecovery skips.
+	_, err = parser.ParseWithConfig(d.content, c)
+	var ufe *parser.UnsortedFieldsError
+	if errors.As(err, &ufe) {
+		for _, f := range ufe.UnsortedFields {
+			line := int(f.Line) - 1
+			if line < 0 || line >= len(d.lineStarts) {
+				line = 0
+			}
+			start := d.lineStarts[line]
+			diagnostics = append(diagnostics, lspDiagnostic{
+				Range:    d.rangeOf(start, d.lineEnd(start)),
+				Severity: lspSeverityError,
+				Source:   "txtpbfmt",
+				Message:  fmt.Sprintf("field %q is not listed in the field order of %q", f.FieldName, f.ParentFieldName),
+			})
+		}
+	} else if err != nil {
+		return nil, nil, err
+	}
+	return nodes, diagnostics, nil
+}
+
+// format returns the edits applying the changes made by formatting the document with the given
+// function.
+func (s *lspServer) format(uri string, d *lspDocument, format func(c config.Config) ([]byte, error)) ([]lspTextEdit, error) {
+	c, err := s.config(uriPath(uri))
+	if err != nil {
+		return nil, err
+	}
+	newContent, err := format(c)
+	if err != nil {
+		return nil, err
+	}
+	// Replace each run of changed lines between unchanged lines.
+	edits := []lspTextEdit{}
+	var cur *lspTextEdit
+	offset := 0
+	for _, chunk := range diff.DiffChunks(splitLines(d.content), splitLines(newContent)) {
+		if len(chunk.Deleted) > 0 || len(chunk.Added) > 0 {
+			if cur == nil {
+				edits = append(edits, lspTextEdit{Range: d.rangeOf(offset, offset)})
+				cur = &edits[len(edits)-1]
+			}
+			for _, l := range chunk.Deleted {
+				offset += len(l)
+			}
+			cur.Range.End = d.position(offset)
+			cur.NewText += strings.Join(chunk.Added, "")
+		}
+		if len(chunk.Equal) > 0 {
+			cur = nil
+			for _, l := range chunk.Equal {
+				offset += len(l)
+			}
+		}
+	}
+	return edits, nil
+}
+
+// documentSymbols returns the outline of the document. Comment-only nodes and the input that
+// couldn't be parsed are left out.
+func documentSymbols(d *lspDocument, nodes []*ast.Node) []lspDocumentSymbol {
+	symbols := []lspDocumentSymbol{}
+	for _, nd := range nodes {
+		if nd.IsCommentOnly() || nd.SyntaxError != "" || nd.Deleted {
+			continue
+		}
+		nameStart := int(nd.FieldStart.Byte)
+		name := nd.Name
+		if name == "" {
+			name = "{}"
+		}
+		nameEnd := nameStart
+		if nd.Name != "" {
+			nameEnd += len(nd.Name)
+		}
+		sym := lspDocumentSymbol{
+			Name:           name,
+			Kind:           lspSymbolKindField,
+			Range:          d.rangeOf(nameStart, int(nd.FieldEnd.Byte)),
+			SelectionRange: d.rangeOf(nameStart, nameEnd),
+		}
+		if len(nd.Children) > 0 || nd.End.Line > 0 {
+			sym.Kind = lspSymbolKindStruct
+			if children := documentSymbols(d, nd.Children); len(children) > 0 {
+				sym.Children = children
+			}
+		} else {
+			var values []string
+			for _, v := range nd.Values {
+				values = append(values, v.Value)
+			}
+			sym.Detail = strings.Join(values, ", ")
+			if nd.ValuesAsList {
+				sym.Detail = "[" + sym.Detail + "]"
+			}
+		}
+		symbols = append(symbols, sym)
+	}
+	return symbols
+}
+
+// foldingRanges returns the folding ranges of the multi-line messages and lists of messages in the
+// document. The line with the closing bracket stays visible.
+func foldingRanges(d *lspDocument, nodes []*ast.Node) []lspFoldingRange {
+	ranges := []lspFoldingRange{}
+	var add func(nodes []*ast.Node)
+	add = func(nodes []*ast.Node) {
+		for _, nd := range nodes {
+			if nd.SyntaxError != "" || nd.Deleted || nd.End.Line == 0 {
+				continue
+			}
+			startLine := d.position(int(nd.FieldStart.Byte)).Line
+			if endLine := int(nd.End.Line) - 2; endLine > startLine {
+				ranges = append(ranges, lspFoldingRange{StartLine: startLine, EndLine: endLine, Kind: lspFoldingRangeKindRegion})
+			}
+			add(nd.Children)
+		}
+	}
+	add(nodes)
+	return ranges
+}
+
+// lspConfig returns the configuration of the language server for the file at path. Documents that
+// aren't files only use the configuration given by the flags.
+func lspConfig(path string) (config.Config, error) {
+	if path == "" {
+		return flagConfig(), nil
+	}
+	return newConfig(path)
+}
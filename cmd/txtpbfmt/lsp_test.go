@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/protocolbuffers/txtpbfmt/config"
+)
+
+// runLSP runs a language server session for the given requests and notifications, and returns
+// the messages written by the server.
+func runLSP(t *testing.T, msgs ...string) []*lspMessage {
+	t.Helper()
+	var in bytes.Buffer
+	for _, m := range msgs {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+	var out bytes.Buffer
+	if err := serveLSP(&in, &out, func(string) (config.Config, error) { return config.Config{}, nil }); err != nil {
+		t.Fatalf("serveLSP returned err %v", err)
+	}
+	s := &lspServer{in: bufio.NewReader(&out)}
+	var res []*lspMessage
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			return res
+		}
+		if err != nil {
+			t.Fatalf("reading server output returned err %v", err)
+		}
+		res = append(res, msg)
+	}
+}
+
+func didOpen(text string) string {
+	textJSON, _ := json.Marshal(text)
+	return `{"jsonrpc":"2.0","method":"textDocument/didOpen","params":{"textDocument":{"uri":"file:///a.textproto","text":` + string(textJSON) + `}}}`
+}
+
+func request(method, params string) string {
+	return `{"jsonrpc":"2.0","id":2,"method":"` + method + `","params":` + params + `}`
+}
+
+const (
+	lspInitialize = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`
+	lspShutdown   = `{"jsonrpc":"2.0","id":3,"method":"shutdown"}`
+	lspExit       = `{"jsonrpc":"2.0","method":"exit"}`
+	lspDoc        = `{"textDocument":{"uri":"file:///a.textproto"}}`
+)
+
+func TestLSP(t *testing.T) {
+	inputs := []struct {
+		name string
+		in   string
+		req  string
+		// want is the JSON result of the request.
+		want string
+		// wantDiagnostics is the JSON diagnostics published for the document.
+		wantDiagnostics string
+	}{{
+		name:            "formatting",
+		in:              "a: 1\nb {c:2}\nd: 3\n",
+		req:             request("textDocument/formatting", lspDoc),
+		want:            `[{"range":{"start":{"line":1,"character":0},"end":{"line":2,"character":0}},"newText":"b { c: 2 }\n"}]`,
+		wantDiagnostics: `[]`,
+	}, {
+		name:            "formatted",
+		in:              "a: 1\n",
+		req:             request("textDocument/formatting", lspDoc),
+		want:            `[]`,
+		wantDiagnostics: `[]`,
+	}, {
+		name: "range formatting",
+		in:   "a:1\nb:2\nc:3\n",
+		req: request("textDocument/rangeFormatting",
+			`{"textDocument":{"uri":"file:///a.textproto"},"range":{"start":{"line":1,"character":0},"end":{"line":2,"character":0}}}`),
+		want:            `[{"range":{"start":{"line":1,"character":0},"end":{"line":2,"character":0}},"newText":"b: 2\n"}]`,
+		wantDiagnostics: `[]`,
+	}, {
+		name: "formatting with syntax error",
+		in:   "a {\n  b: \"x\n}\n",
+		req:  request("textDocument/formatting", lspDoc),
+		wantDiagnostics: `[{"range":{"start":{"line":1,"character":7},"end":{"line":1,"character":7}},"severity":1,` +
+			`"code":"newline in string","source":"txtpbfmt","message":"found literal (unescaped) new line in string"}]`,
+	}, {
+		name: "document symbols",
+		in:   "# comment\nname: \"é😀\" a {\n  b: [1, 2]\n}\n",
+		req:  request("textDocument/documentSymbol", lspDoc),
+		want: `[{"name":"name","detail":"\"é😀\"","kind":8,` +
+			`"range":{"start":{"line":1,"character":0},"end":{"line":1,"character":11}},` +
+			`"selectionRange":{"start":{"line":1,"character":0},"end":{"line":1,"character":4}}},` +
+			`{"name":"a","kind":23,` +
+			`"range":{"start":{"line":1,"character":12},"end":{"line":3,"character":1}},` +
+			`"selectionRange":{"start":{"line":1,"character":12},"end":{"line":1,"character":13}},` +
+			`"children":[{"name":"b","detail":"[1, 2]","kind":8,` +
+			`"range":{"start":{"line":2,"character":2},"end":{"line":2,"character":11}},` +
+			`"selectionRange":{"start":{"line":2,"character":2},"end":{"line":2,"character":3}}}]}]`,
+		wantDiagnostics: `[]`,
+	}, {
+		name:            "folding ranges",
+		in:              "a {\n  b {\n    c: 1\n  }\n  d { e: 1 }\n}\n",
+		req:             request("textDocument/foldingRange", lspDoc),
+		want:            `[{"startLine":0,"endLine":4,"kind":"region"},{"startLine":1,"endLine":2,"kind":"region"}]`,
+		wantDiagnostics: `[]`,
+	}}
+	for _, input := range inputs {
+		msgs := runLSP(t, lspInitialize, didOpen(input.in), input.req, lspShutdown, lspExit)
+		var gotDiagnostics, got, gotErr string
+		for _, msg := range msgs {
+			switch {
+			case msg.Method == "textDocument/publishDiagnostics":
+				var params struct{ Diagnostics json.RawMessage }
+				if err := json.Unmarshal(msg.Params, &params); err != nil {
+					t.Fatal(err)
+				}
+				gotDiagnostics = string(params.Diagnostics)
+			case msg.ID != nil && string(*msg.ID) == "2":
+				got = string(msg.Result)
+				if msg.Error != nil {
+					gotErr = msg.Error.Message
+				}
+			}
+		}
+		if input.want == "" {
+			if gotErr == "" {
+				t.Errorf("LSP[%s] returned result %s, want error", input.name, got)
+			}
+		} else if diff := cmp.Diff(input.want, got); diff != "" {
+			t.Errorf("LSP[%s] returned diff (-want, +got):\n%s", input.name, diff)
+		}
+		if diff := cmp.Diff(input.wantDiagnostics, gotDiagnostics); diff != "" {
+			t.Errorf("LSP[%s] published diagnostics diff (-want, +got):\n%s", input.name, diff)
+		}
+	}
+}
+
+func TestLSPErrors(t *testing.T) {
+	msgs := runLSP(t, lspInitialize,
+		request("textDocument/formatting", `{"textDocument":{"uri":"file:///unknown.textproto"}}`),
+		request("workspace/symbol", `{}`),
+		lspShutdown, lspExit)
+	var got []string
+	for _, msg := range msgs {
+		if msg.Error != nil {
+			got = append(got, msg.Error.Message)
+		}
+	}
+	want := []string{
+		"document is not open: file:///unknown.textproto",
+		"method not supported: workspace/symbol",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("LSP returned errors diff (-want, +got):\n%s", diff)
+	}
+
+	var out bytes.Buffer
+	in := strings.NewReader(fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(lspExit), lspExit))
+	if err := serveLSP(in, &out, nil); err == nil {
+		t.Errorf("serveLSP with exit before shutdown returned err=nil, want error")
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/config"
+	"github.com/protocolbuffers/txtpbfmt/impl"
+	"github.com/protocolbuffers/txtpbfmt/merge"
+	"github.com/protocolbuffers/txtpbfmt/parser"
+)
+
+// exitCodeConflicts is the exit status of txtpbfmt merge when the merged content has conflicts, as
+// expected from git merge drivers.
+const exitCodeConflicts = 1
+
+// mergeFiles merges the changes from the file at basePath to the file at theirsPath into the file at
+// oursPath, and returns the merged content and the number of conflicts. Repeated messages are
+// matched by the SortRepeatedFieldsBySubfield specs of c, and the result is indented as configured
+// by c. As when formatting, the meta comments of ours are applied to c first.
+func mergeFiles(basePath, oursPath, theirsPath string, c config.Config) ([]byte, int, error) {
+	content, err := read(oursPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := impl.AddMetaCommentsToConfig(content, &c); err != nil {
+		return nil, 0, fmt.Errorf("parsing %s: %v", oursPath, err)
+	}
+	var trees [3][]*ast.Node
+	for i, path := range []string{basePath, oursPath, theirsPath} {
+		nodes, err := parseFile(path, c)
+		if err != nil {
+			return nil, 0, err
+		}
+		trees[i] = nodes
+	}
+	opts := []merge.Option{merge.PrintConfig(c)}
+	for _, spec := range c.SortRepeatedFieldsBySubfield {
+		if spec != "" {
+			opts = append(opts, merge.KeyBySubfield(spec))
+		}
+	}
+	nodes, conflicts := merge.Merge(trees[0], trees[1], trees[2], opts...)
+	return parser.PrettyBytesWithConfig(nodes, 0, c), conflicts, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kylelemons/godebug/diff"
+	"github.com/protocolbuffers/txtpbfmt/config"
+)
+
+func TestMergeFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.textproto": `job { name: "x" cpu: 1 }
+job { name: "y" cpu: 1 }
+`,
+		"ours.textproto": `# Jobs.
+job { name: "y" cpu: 2 }
+job { name: "x" cpu: 1 }
+`,
+		"theirs.textproto": `job { name: "x" cpu: 3 }
+job { name: "y" cpu: 4 }
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := config.Config{SortRepeatedFieldsBySubfield: []string{"job.name"}}
+	got, conflicts, err := mergeFiles(filepath.Join(dir, "base.textproto"), filepath.Join(dir, "ours.textproto"), filepath.Join(dir, "theirs.textproto"), c)
+	if err != nil {
+		t.Fatalf("mergeFiles returned err %v", err)
+	}
+	want := `# Jobs.
+job {
+  name: "y"
+<<<<<<< ours
+  cpu: 2
+=======
+  cpu: 4
+>>>>>>> theirs
+}
+job { name: "x" cpu: 3 }
+`
+	if diff := diff.Diff(want, string(got)); diff != "" {
+		t.Errorf("mergeFiles returned diff (-want, +got):\n%s", diff)
+	}
+	if conflicts != 1 {
+		t.Errorf("mergeFiles returned %d conflicts, want 1", conflicts)
+	}
+}
+
+func TestMergeFilesAppliesMetaCommentsOfOurs(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.textproto":   "job {\n  cpu: 1\n}\n",
+		"ours.textproto":   "# txtpbfmt: indent_width=4\n\njob {\n    cpu: 1\n    ram: 2\n}\n",
+		"theirs.textproto": "job {\n  cpu: 3\n}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, _, err := mergeFiles(filepath.Join(dir, "base.textproto"), filepath.Join(dir, "ours.textproto"), filepath.Join(dir, "theirs.textproto"), config.Config{})
+	if err != nil {
+		t.Fatalf("mergeFiles returned err %v", err)
+	}
+	want := "# txtpbfmt: indent_width=4\n\njob {\n    cpu: 3\n    ram: 2\n}\n"
+	if diff := diff.Diff(want, string(got)); diff != "" {
+		t.Errorf("mergeFiles returned diff (-want, +got):\n%s", diff)
+	}
+}
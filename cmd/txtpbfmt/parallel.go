@@ -0,0 +1,55 @@
+package main
+
+import "sync"
+
+// result holds the outcome of processing a single path.
+type result struct {
+	// Whether formatting changed the content.
+	changed bool
+	// Output for stdout, printed once all preceding paths have been reported.
+	out []byte
+	err error
+}
+
+// processAll calls process for every path using up to jobs goroutines, and
+// calls report for every path in the order of paths as soon as its result and
+// the results of all preceding paths are available. Errors don't stop the
+// processing of other paths; they are passed on to report.
+func processAll(paths []string, jobs int, process func(path string) result, report func(path string, r result)) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(paths) {
+		jobs = len(paths)
+	}
+	results := make([]result, len(paths))
+	done := make([]chan struct{}, len(paths))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for j := 0; j < jobs; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i] = process(paths[i])
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range paths {
+			indices <- i
+		}
+		close(indices)
+	}()
+	for i, path := range paths {
+		<-done[i]
+		report(path, results[i])
+		// Release the output as soon as it has been reported.
+		results[i] = result{}
+	}
+	wg.Wait()
+}
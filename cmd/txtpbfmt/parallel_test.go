@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProcessAll(t *testing.T) {
+	var paths []string
+	for i := 0; i < 50; i++ {
+		paths = append(paths, strconv.Itoa(i))
+	}
+	for _, jobs := range []int{0, 1, 4, 100} {
+		var got []string
+		errs := 0
+		processAll(paths, jobs, func(path string) result {
+			i, _ := strconv.Atoi(path)
+			// Make later paths finish first.
+			time.Sleep(time.Duration(len(paths)-i) * 10 * time.Microsecond)
+			r := result{out: []byte(path)}
+			if i%7 == 0 {
+				r.err = fmt.Errorf("error for %s", path)
+			}
+			return r
+		}, func(path string, r result) {
+			if path != string(r.out) {
+				t.Errorf("processAll(jobs=%d) reported result %q for path %q", jobs, r.out, path)
+			}
+			if r.err != nil {
+				errs++
+			}
+			got = append(got, path)
+		})
+		if diff := cmp.Diff(paths, got); diff != "" {
+			t.Errorf("processAll(jobs=%d) reported paths in wrong order (-want, +got):\n%s", jobs, diff)
+		}
+		if errs != 8 {
+			t.Errorf("processAll(jobs=%d) reported %d errors, want 8", jobs, errs)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/config"
+	txtpbdiff "github.com/protocolbuffers/txtpbfmt/diff"
+	"github.com/protocolbuffers/txtpbfmt/impl"
+)
+
+// diffFiles writes the structural changes from the file at oldPath to the file at newPath to out,
+// one per line. Repeated messages are matched by the SortRepeatedFieldsBySubfield specs of c.
+func diffFiles(oldPath, newPath string, c config.Config, out io.Writer) error {
+	oldNodes, err := parseFile(oldPath, c)
+	if err != nil {
+		return err
+	}
+	newNodes, err := parseFile(newPath, c)
+	if err != nil {
+		return err
+	}
+	var opts []txtpbdiff.Option
+	for _, spec := range c.SortRepeatedFieldsBySubfield {
+		if spec != "" {
+			opts = append(opts, txtpbdiff.KeyBySubfield(spec))
+		}
+	}
+	for _, change := range txtpbdiff.Diff(oldNodes, newNodes, opts...) {
+		if _, err := fmt.Fprintln(out, change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseFile parses the file at path in input order: neither c nor the meta comments of the file
+// make it sort or remove duplicates.
+func parseFile(path string, c config.Config) ([]*ast.Node, error) {
+	content, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	pc := config.Config{AllowTripleQuotedStrings: c.AllowTripleQuotedStrings}
+	if err := impl.AddMetaCommentsToConfig(content, &pc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	nodes, err := impl.ParseUnsorted(content, pc)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kylelemons/godebug/diff"
+	"github.com/protocolbuffers/txtpbfmt/config"
+)
+
+func TestDiffFiles(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.textproto")
+	newPath := filepath.Join(dir, "new.textproto")
+	if err := os.WriteFile(oldPath, []byte(`# Jobs.
+job { name: "x" cpu: 1 }
+job { name: "y" cpu: 2 }
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newPath, []byte(`job {
+  name: "y"
+  cpu: 2
+}
+job {
+  name: "x"
+  cpu: 4
+}
+job { name: "z" }
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	c := config.Config{SortRepeatedFieldsBySubfield: []string{"job.name"}}
+	if err := diffFiles(oldPath, newPath, c, &out); err != nil {
+		t.Fatalf("diffFiles returned err %v", err)
+	}
+	want := `~ job[0].cpu: 1 -> 4
++ job[2]: { name: "z" }
+`
+	if diff := diff.Diff(want, out.String()); diff != "" {
+		t.Errorf("diffFiles returned diff (-want, +got):\n%s", diff)
+	}
+
+	if err := os.WriteFile(newPath, []byte("job { name: \"x\n\" }"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := diffFiles(oldPath, newPath, config.Config{}, &out); err == nil || !strings.Contains(err.Error(), newPath) {
+		t.Errorf("diffFiles with invalid file returned err %v, want error mentioning %s", err, newPath)
+	}
+}
+
+func TestDiffFilesIgnoresSortMetaComments(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.textproto")
+	newPath := filepath.Join(dir, "new.textproto")
+	meta := "# txtpbfmt: sort_repeated_fields_by_content\n# txtpbfmt: remove_duplicate_values_for_repeated_fields\n\n"
+	if err := os.WriteFile(oldPath, []byte(meta+"a: 2\na: 1\na: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newPath, []byte(meta+"a: 1\na: 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := diffFiles(oldPath, newPath, config.Config{}, &out); err != nil {
+		t.Fatalf("diffFiles returned err %v", err)
+	}
+	// Sorted and without duplicates, both files would have the same values.
+	want := `- a[0]: 2
+~ a[2]: 1 -> 2
+`
+	if diff := diff.Diff(want, out.String()); diff != "" {
+		t.Errorf("diffFiles returned diff (-want, +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// walkOptions controls which files are found when walking directories.
+type walkOptions struct {
+	// File extensions (including the leading '.') that are formatted.
+	extensions []string
+	// Glob patterns for files and directories to skip. A pattern matches if it
+	// matches either the base name or the full slash-separated path.
+	exclude []string
+}
+
+// splitList splits a comma-separated flag value, dropping empty elements.
+func splitList(s string) []string {
+	var res []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+func (o walkOptions) isExcluded(path string) bool {
+	slashPath := filepath.ToSlash(path)
+	base := filepath.Base(path)
+	for _, pattern := range o.exclude {
+		if ok, _ := filepath.Match(pattern, base); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, slashPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (o walkOptions) hasExtension(path string) bool {
+	ext := filepath.Ext(path)
+	for _, e := range o.extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// skipDir reports whether the directory at path, below a walked root, should
+// not be descended into.
+func (o walkOptions) skipDir(path string) bool {
+	base := filepath.Base(path)
+	if strings.HasPrefix(base, ".") || base == "vendor" {
+		return true
+	}
+	return o.isExcluded(path)
+}
+
+// expandPaths replaces directory arguments, and arguments of the form "dir/...",
+// with the files below them that have one of the configured extensions. Other
+// arguments are returned unchanged, so that explicitly named files are always
+// processed. The order of the arguments is preserved, and files found in a
+// directory are in lexical order.
+func expandPaths(args []string, o walkOptions) ([]string, error) {
+	var paths []string
+	for _, arg := range args {
+		root := arg
+		if arg == "..." {
+			root = "."
+		} else if strings.HasSuffix(arg, "/...") {
+			root = strings.TrimSuffix(arg, "/...")
+		}
+		info, err := os.Stat(root)
+		if err != nil || !info.IsDir() {
+			// Let processPath report missing files.
+			paths = append(paths, arg)
+			continue
+		}
+		err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != root && o.skipDir(path) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if o.hasExtension(path) && !o.isExcluded(path) {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
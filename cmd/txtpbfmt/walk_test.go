@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExpandPaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{
+		"a.textproto",
+		"b.txtpb",
+		"c.txt",
+		"sub/d.pbtxt",
+		"sub/e.asciipb",
+		"sub/generated/f.textproto",
+		"sub/g_test.textproto",
+		".hidden/h.textproto",
+		"vendor/i.textproto",
+	} {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defaults := walkOptions{extensions: splitList(".textproto,.txtpb,.pbtxt,.asciipb")}
+	inputs := []struct {
+		name string
+		args []string
+		opts walkOptions
+		want []string
+	}{{
+		name: "directory",
+		args: []string{dir},
+		opts: defaults,
+		want: []string{"a.textproto", "b.txtpb", "sub/d.pbtxt", "sub/e.asciipb", "sub/g_test.textproto", "sub/generated/f.textproto"},
+	}, {
+		name: "recursive pattern",
+		args: []string{filepath.Join(dir, "sub") + "/..."},
+		opts: defaults,
+		want: []string{"sub/d.pbtxt", "sub/e.asciipb", "sub/g_test.textproto", "sub/generated/f.textproto"},
+	}, {
+		name: "explicit files are kept",
+		args: []string{filepath.Join(dir, "c.txt"), filepath.Join(dir, "vendor/i.textproto")},
+		opts: defaults,
+		want: []string{"c.txt", "vendor/i.textproto"},
+	}, {
+		name: "exclude",
+		args: []string{dir},
+		opts: walkOptions{extensions: defaults.extensions, exclude: []string{"generated", "*_test.textproto", "*.txtpb"}},
+		want: []string{"a.textproto", "sub/d.pbtxt", "sub/e.asciipb"},
+	}, {
+		name: "extensions",
+		args: []string{dir},
+		opts: walkOptions{extensions: []string{".txt"}},
+		want: []string{"c.txt"},
+	}}
+	for _, input := range inputs {
+		paths, err := expandPaths(input.args, input.opts)
+		if err != nil {
+			t.Errorf("expandPaths[%s] returned err %v", input.name, err)
+			continue
+		}
+		var got []string
+		for _, p := range paths {
+			rel, err := filepath.Rel(dir, p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, filepath.ToSlash(rel))
+		}
+		if diff := cmp.Diff(input.want, got); diff != "" {
+			t.Errorf("expandPaths[%s] returned diff (-want, +got):\n%s", input.name, diff)
+		}
+	}
+}
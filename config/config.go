@@ -2,6 +2,9 @@
 package config
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/protocolbuffers/txtpbfmt/logger"
 )
 
@@ -17,6 +20,18 @@ type Config struct {
 	// Skip colons whenever possible.
 	SkipAllColons bool
 
+	// Write a colon between the name and the opening bracket of messages and lists of messages.
+	// SkipAllColons takes precedence.
+	ColonsBeforeMessages bool
+
+	// Write a colon between the name and the value of scalar fields and lists of values, even if the
+	// input omits it.
+	ColonsBeforeScalars bool
+
+	// How to write the separators between the fields of messages written on one line. Separators
+	// are never written between fields on lines of their own.
+	Separators SeparatorStyle
+
 	// Allow unnamed nodes everywhere.
 	// Default is to allow only top-level nodes to be unnamed.
 	AllowUnnamedNodesEverywhere bool
@@ -73,6 +88,33 @@ type Config struct {
 	// Use single quotes around strings that contain double but not single quotes.
 	SmartQuotes bool
 
+	// Number of spaces for each level of indentation. If zero, DefaultIndentWidth is used.
+	// With UseTabs, this is the width of a tab assumed when wrapping strings.
+	IndentWidth int
+
+	// Indent with a tab for each level of indentation instead of spaces.
+	UseTabs bool
+
+	// Max columns for messages and lists written on one line. If non-zero, the layout of the input is
+	// ignored: messages and lists without comments are written on one line if they fit within this
+	// width, and expanded otherwise. Has no effect with ExpandAllChildren.
+	MaxLineWidth int
+
+	// Pad the names of adjacent scalar fields so that their values start at the same column. Fields
+	// are aligned within blocks delimited by blank lines and comment-only lines, at each level.
+	AlignValues bool
+
+	// Align the inline comments at the end of adjacent one-line fields, within the same blocks as
+	// AlignValues.
+	AlignComments bool
+
+	// Print in the layout of a protobuf TextFormat printer, see CanonicalStyle. Comments are kept
+	// unless RemoveComments is set. The printer options above have no effect in this mode.
+	Canonical CanonicalStyle
+
+	// Remove all comments and blank lines, including MetaComments.
+	RemoveComments bool
+
 	// Logger enables logging when it is non-nil.
 	// If the log messages aren't going to be useful, it's best to leave Logger
 	// set to nil, as otherwise log messages will be constructed.
@@ -91,6 +133,81 @@ func (c *Config) InfoLevel() bool {
 	return c.Logger != nil
 }
 
+// DefaultIndentWidth is the number of spaces for each level of indentation when
+// Config.IndentWidth is zero.
+const DefaultIndentWidth = 2
+
+// Indent returns the string written for each level of indentation.
+func (c *Config) Indent() string {
+	if c.UseTabs {
+		return "\t"
+	}
+	return strings.Repeat(" ", c.IndentColumns())
+}
+
+// IndentColumns returns the number of columns taken by each level of indentation.
+func (c *Config) IndentColumns() int {
+	if c.IndentWidth > 0 {
+		return c.IndentWidth
+	}
+	return DefaultIndentWidth
+}
+
+// SeparatorStyle is the style of the separators between the fields of messages written on one
+// line.
+type SeparatorStyle string
+
+const (
+	// RemoveSeparators writes no separators, e.g. "{ a: 1 b: 2 }". This is the default.
+	RemoveSeparators SeparatorStyle = ""
+	// PreserveSeparators writes the separators of the input, e.g. "{ a: 1, b: 2; }".
+	PreserveSeparators SeparatorStyle = "preserve"
+	// CommaSeparators writes a comma after each field but the last, e.g. "{ a: 1, b: 2 }".
+	CommaSeparators SeparatorStyle = "comma"
+	// SemicolonSeparators writes a semicolon after each field but the last, e.g. "{ a: 1; b: 2 }".
+	SemicolonSeparators SeparatorStyle = "semicolon"
+)
+
+// ParseSeparatorStyle parses the name of a SeparatorStyle: "remove", "preserve", "comma" or
+// "semicolon", as used by the separators MetaComment.
+func ParseSeparatorStyle(name string) (SeparatorStyle, error) {
+	switch s := SeparatorStyle(name); s {
+	case PreserveSeparators, CommaSeparators, SemicolonSeparators:
+		return s, nil
+	case "remove":
+		return RemoveSeparators, nil
+	}
+	return "", fmt.Errorf("separators should be remove, preserve, comma or semicolon, got: %q", name)
+}
+
+// CanonicalStyle is the protobuf TextFormat printer whose output is reproduced in canonical mode.
+// In all styles, each field is on a line of its own, indented by two spaces, lists are written as
+// repeated fields, strings are written as a single double-quoted literal, and hexadecimal and octal
+// integers in decimal. As the type of fields isn't known, floating-point literals are written as
+// doubles.
+type CanonicalStyle string
+
+const (
+	// CanonicalCpp is the style of the C++ TextFormat::Printer: no colon before messages, strings
+	// escaped with octal escapes for bytes that aren't printable ASCII, and floating-point numbers
+	// with 15 significant digits, or 17 if needed to read back the same number.
+	CanonicalCpp CanonicalStyle = "cpp"
+	// CanonicalGo is the style of Go's prototext.Format: a colon before messages, "{}" for empty
+	// messages, strings with UTF-8 kept and hexadecimal escapes for control characters, and the
+	// shortest floating-point literals that read back the same number.
+	CanonicalGo CanonicalStyle = "go"
+)
+
+// ParseCanonicalStyle parses the name of a CanonicalStyle: "cpp" or "go", as used by the canonical
+// MetaComment.
+func ParseCanonicalStyle(name string) (CanonicalStyle, error) {
+	switch s := CanonicalStyle(name); s {
+	case CanonicalCpp, CanonicalGo:
+		return s, nil
+	}
+	return "", fmt.Errorf("canonical style should be cpp or go, got: %q", name)
+}
+
 // RootName contains a constant that can be used to identify the root of all Nodes.
 const RootName = "__ROOT__"
 
@@ -103,3 +220,22 @@ func (c *Config) AddFieldSortOrder(nodeName string, fieldOrder ...string) {
 	}
 	c.FieldSortOrder[nodeName] = fieldOrder
 }
+
+// ParseFieldSortOrder parses a field order of the form "<node name>:<field>,<field>,...", as used
+// by the field_order MetaComment, into the arguments of AddFieldSortOrder.
+func ParseFieldSortOrder(spec string) (nodeName string, fieldOrder []string, err error) {
+	nodeName, fields, ok := strings.Cut(spec, ":")
+	nodeName = strings.TrimSpace(nodeName)
+	if !ok || nodeName == "" {
+		return "", nil, fmt.Errorf("field order should be <node name>:<field>,<field>,..., got: %q", spec)
+	}
+	for _, f := range strings.Split(fields, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fieldOrder = append(fieldOrder, f)
+		}
+	}
+	if len(fieldOrder) == 0 {
+		return "", nil, fmt.Errorf("field order for %q has no fields", nodeName)
+	}
+	return nodeName, fieldOrder, nil
+}
@@ -123,3 +123,41 @@ func TestAddFieldSortOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestParseFieldSortOrder(t *testing.T) {
+	tests := []struct {
+		spec           string
+		wantNodeName   string
+		wantFieldOrder []string
+		wantErr        bool
+	}{{
+		spec:           "Job:name,owner,schedule",
+		wantNodeName:   "Job",
+		wantFieldOrder: []string{"name", "owner", "schedule"},
+	}, {
+		spec:           " __ROOT__ : a, b ,",
+		wantNodeName:   RootName,
+		wantFieldOrder: []string{"a", "b"},
+	}, {
+		spec:    "name,owner",
+		wantErr: true,
+	}, {
+		spec:    ":name",
+		wantErr: true,
+	}, {
+		spec:    "Job:",
+		wantErr: true,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.spec, func(t *testing.T) {
+			nodeName, fieldOrder, err := ParseFieldSortOrder(tc.spec)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ParseFieldSortOrder(%q) err = %v, want error: %v", tc.spec, err, tc.wantErr)
+			}
+			if nodeName != tc.wantNodeName || !reflect.DeepEqual(fieldOrder, tc.wantFieldOrder) {
+				t.Errorf("ParseFieldSortOrder(%q) = %q, %v, want %q, %v", tc.spec, nodeName, fieldOrder, tc.wantNodeName, tc.wantFieldOrder)
+			}
+		})
+	}
+}
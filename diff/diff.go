@@ -0,0 +1,434 @@
+// Package diff computes the structural differences between two parse trees, as a list of fields
+// that were added, removed or changed.
+//
+// Fields are compared by content: comments, positions and formatting are ignored, the order of
+// fields with different names doesn't matter, and lists (e.g. "a: [1, 2]") are treated as the
+// corresponding repeated fields. Values are compared as written, except for strings, which are
+// compared unquoted.
+//
+// Repeated fields are aligned by position, so that inserting a field only reports that field. Use
+// KeyBySubfield to match repeated messages by the value of a subfield instead, so that reordering
+// them isn't reported as a change.
+//
+// The path of each change is the canonical path of the field, as returned by ast.NodeIndex.Path,
+// which the query package resolves to that field.
+package diff
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/unquote"
+)
+
+// Kind is the kind of a Change.
+type Kind int
+
+const (
+	// Added is for fields only present in the new tree.
+	Added Kind = iota
+	// Removed is for fields only present in the old tree.
+	Removed
+	// Changed is for fields whose value changed, or which changed between scalar and message.
+	Changed
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Change describes a field that differs between the two trees.
+type Change struct {
+	Kind Kind
+	// Path is the canonical path of the field, see ast.NodeIndex.Path, e.g. `job[2].task[1].cpu`. It
+	// is the path in the old tree, except for added fields. The values of a list of values aren't
+	// nodes of their own, so their path is that of the list, e.g. `tags` for `tags: [1, 2]`.
+	Path string
+	// Old is the field in the old tree, or nil for added fields. For a value of a list of values,
+	// this is a node with the name of the list and only that value.
+	Old *ast.Node
+	// New is the field in the new tree, or nil for removed fields, like Old.
+	New *ast.Node
+}
+
+// String returns a single-line description of the change, e.g. `~ job.cpu: 2 -> 4`, with + for
+// added fields and - for removed fields.
+func (c Change) String() string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("+ %s: %s", c.Path, formatValue(c.New))
+	case Removed:
+		return fmt.Sprintf("- %s: %s", c.Path, formatValue(c.Old))
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Path, formatValue(c.Old), formatValue(c.New))
+}
+
+type options struct {
+	keys []key
+}
+
+type key struct {
+	// field is the name of the repeated messages, or empty for all.
+	field        string
+	subfieldPath []string
+}
+
+// An Option configures Diff.
+type Option func(*options)
+
+// KeyBySubfield makes Diff match repeated messages by the value of a subfield. The spec has the
+// format of config.Config.SortRepeatedFieldsBySubfield: "{field}.{subfield1}.{subfield2}..." for
+// the messages of the given field name, or "{subfield}" for all repeated messages.
+//
+// Messages without the subfield are aligned by position.
+func KeyBySubfield(spec string) Option {
+	parts := strings.Split(spec, ".")
+	k := key{subfieldPath: parts}
+	if len(parts) > 1 {
+		k = key{field: parts[0], subfieldPath: parts[1:]}
+	}
+	return func(o *options) {
+		o.keys = append(o.keys, k)
+	}
+}
+
+// Diff returns the changes from the old nodes a to the new nodes b, in the order in which the fields
+// first appear in a and then in b.
+func Diff(a, b []*ast.Node, opts ...Option) []Change {
+	d := &differ{oldIndex: ast.Index(a), newIndex: ast.Index(b), origins: map[*ast.Node]*ast.Node{}}
+	for _, opt := range opts {
+		opt(&d.options)
+	}
+	d.diffNodes(a, b)
+	return d.changes
+}
+
+type differ struct {
+	options
+	changes            []Change
+	oldIndex, newIndex *ast.NodeIndex
+	// origins maps the fields made for the values and messages of lists to the nodes in the trees
+	// they come from: the list for values, and the message itself for messages.
+	origins map[*ast.Node]*ast.Node
+}
+
+func (d *differ) add(kind Kind, old, new *ast.Node) {
+	nd, x := old, d.oldIndex
+	if kind == Added {
+		nd, x = new, d.newIndex
+	}
+	if o, ok := d.origins[nd]; ok {
+		nd = o
+	}
+	d.changes = append(d.changes, Change{Kind: kind, Path: x.Path(nd), Old: d.node(old), New: d.node(new)})
+}
+
+// node returns the node to report for the field nd: the message itself for messages of lists.
+func (d *differ) node(nd *ast.Node) *ast.Node {
+	if o, ok := d.origins[nd]; ok && !o.ValuesAsList {
+		return o
+	}
+	return nd
+}
+
+// diffNodes diffs the children of two messages.
+func (d *differ) diffNodes(a, b []*ast.Node) {
+	as, bs := fields(a, d.origins), fields(b, d.origins)
+	var names []string
+	seen := map[string]bool{}
+	for _, nodes := range [][]*ast.Node{as, bs} {
+		for _, nd := range nodes {
+			if !seen[nd.Name] {
+				seen[nd.Name] = true
+				names = append(names, nd.Name)
+			}
+		}
+	}
+	for _, name := range names {
+		d.diffRepeated(name, byName(as, name), byName(bs, name))
+	}
+}
+
+// diffRepeated diffs the fields with the same name within two messages.
+func (d *differ) diffRepeated(name string, a, b []*ast.Node) {
+	switch {
+	case len(a) == 0 && len(b) == 1:
+		d.add(Added, nil, b[0])
+		return
+	case len(a) == 1 && len(b) == 0:
+		d.add(Removed, a[0], nil)
+		return
+	case len(a) == 1 && len(b) == 1:
+		d.diffField(a[0], b[0])
+		return
+	}
+	// Indices of the fields that aren't matched by key.
+	var ia, ib []int
+	if k, ok := d.key(name); ok {
+		used := make([]bool, len(b))
+		for i, x := range a {
+			kx, ok := keyValue(x, k.subfieldPath)
+			if !ok {
+				ia = append(ia, i)
+				continue
+			}
+			j := -1
+			for jj, y := range b {
+				if ky, ok := keyValue(y, k.subfieldPath); ok && !used[jj] && ky == kx {
+					j = jj
+					break
+				}
+			}
+			if j < 0 {
+				d.add(Removed, x, nil)
+				continue
+			}
+			used[j] = true
+			d.diffField(x, b[j])
+		}
+		for j, y := range b {
+			if used[j] {
+				continue
+			}
+			if _, ok := keyValue(y, k.subfieldPath); ok {
+				d.add(Added, nil, y)
+			} else {
+				ib = append(ib, j)
+			}
+		}
+	} else {
+		for i := range a {
+			ia = append(ia, i)
+		}
+		for j := range b {
+			ib = append(ib, j)
+		}
+	}
+	d.diffPositional(a, b, ia, ib)
+}
+
+// diffPositional diffs the fields a[ia] and b[ib], aligning the equal ones. The fields in between
+// are diffed pairwise, and the remaining ones are added or removed.
+func (d *differ) diffPositional(a, b []*ast.Node, ia, ib []int) {
+	// lcs[i][j] is the length of the longest common subsequence of ia[i:] and ib[j:].
+	lcs := make([][]int, len(ia)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(ib)+1)
+	}
+	for i := len(ia) - 1; i >= 0; i-- {
+		for j := len(ib) - 1; j >= 0; j-- {
+			switch {
+			case equalField(a[ia[i]], b[ib[j]]):
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var removed, added []int
+	flush := func() {
+		for n := 0; n < len(removed) || n < len(added); n++ {
+			switch {
+			case n >= len(added):
+				d.add(Removed, a[removed[n]], nil)
+			case n >= len(removed):
+				d.add(Added, nil, b[added[n]])
+			default:
+				d.diffField(a[removed[n]], b[added[n]])
+			}
+		}
+		removed, added = nil, nil
+	}
+	i, j := 0, 0
+	for i < len(ia) || j < len(ib) {
+		switch {
+		case i < len(ia) && j < len(ib) && equalField(a[ia[i]], b[ib[j]]):
+			flush()
+			i++
+			j++
+		case j == len(ib) || (i < len(ia) && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, ia[i])
+			i++
+		default:
+			added = append(added, ib[j])
+			j++
+		}
+	}
+	flush()
+}
+
+// diffField diffs two fields with the same name.
+func (d *differ) diffField(a, b *ast.Node) {
+	switch {
+	case a.Children != nil && b.Children != nil:
+		d.diffNodes(a.Children, b.Children)
+	case a.Children != nil || b.Children != nil || !equalValues(a, b):
+		d.add(Changed, a, b)
+	}
+}
+
+// key returns the key of the repeated fields with the given name, if any.
+func (d *differ) key(name string) (key, bool) {
+	for _, k := range d.keys {
+		if k.field == "" || k.field == name {
+			return k, true
+		}
+	}
+	return key{}, false
+}
+
+// keyValue returns the value of the subfield at path of the message nd, as a query literal.
+func keyValue(nd *ast.Node, path []string) (string, bool) {
+	for _, name := range path {
+		next := byName(fields(nd.Children, nil), name)
+		if len(next) != 1 {
+			return "", false
+		}
+		nd = next[0]
+	}
+	if len(nd.Values) == 0 {
+		return "", false
+	}
+	if s, _, err := unquote.Unquote(nd); err == nil {
+		return strconv.Quote(s), true
+	}
+	if len(nd.Values) > 1 {
+		return "", false
+	}
+	return nd.Values[0].Value, true
+}
+
+// fields returns the fields among nodes, without comments and deleted nodes. Each value or message
+// of a list is returned as a separate field, which is mapped to the node it comes from in origins
+// unless origins is nil.
+func fields(nodes []*ast.Node, origins map[*ast.Node]*ast.Node) []*ast.Node {
+	var res []*ast.Node
+	for _, nd := range nodes {
+		switch {
+		case nd.Deleted || nd.IsCommentOnly():
+		case nd.ValuesAsList:
+			for _, v := range nd.Values {
+				f := &ast.Node{Start: nd.Start, Name: nd.Name, Values: []*ast.Value{v}}
+				if origins != nil {
+					origins[f] = nd
+				}
+				res = append(res, f)
+			}
+		case nd.ChildrenAsList:
+			for _, item := range nd.Children {
+				if !item.Deleted && !item.IsCommentOnly() {
+					c := *item
+					c.Name = nd.Name
+					if origins != nil {
+						origins[&c] = item
+					}
+					res = append(res, &c)
+				}
+			}
+		default:
+			res = append(res, nd)
+		}
+	}
+	return res
+}
+
+func byName(nodes []*ast.Node, name string) []*ast.Node {
+	var res []*ast.Node
+	for _, nd := range nodes {
+		if nd.Name == name {
+			res = append(res, nd)
+		}
+	}
+	return res
+}
+
+// equalField reports whether two fields with the same name have the same content.
+func equalField(a, b *ast.Node) bool {
+	if a.Children == nil || b.Children == nil {
+		return a.Children == nil && b.Children == nil && equalValues(a, b)
+	}
+	as, bs := fields(a.Children, nil), fields(b.Children, nil)
+	if len(as) != len(bs) {
+		return false
+	}
+	names := map[string]bool{}
+	for _, nd := range as {
+		names[nd.Name] = true
+	}
+	for name := range names {
+		x, y := byName(as, name), byName(bs, name)
+		if len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalField(x[i], y[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// equalValues reports whether two scalar fields have the same values as written, or the same
+// unquoted string.
+func equalValues(a, b *ast.Node) bool {
+	if len(a.Values) == len(b.Values) {
+		equal := true
+		for i, v := range a.Values {
+			equal = equal && v.Value == b.Values[i].Value
+		}
+		if equal {
+			return true
+		}
+	}
+	sa, _, errA := unquote.Unquote(a)
+	sb, _, errB := unquote.Unquote(b)
+	return errA == nil && errB == nil && sa == sb
+}
+
+// formatValue returns the value of a field on a single line, without comments.
+func formatValue(nd *ast.Node) string {
+	if nd.Children == nil {
+		var values []string
+		for _, v := range nd.Values {
+			values = append(values, v.Value)
+		}
+		if nd.ValuesAsList {
+			return "[" + strings.Join(values, ", ") + "]"
+		}
+		return strings.Join(values, " ")
+	}
+	var children []string
+	for _, c := range nd.Children {
+		if c.Deleted || c.IsCommentOnly() {
+			continue
+		}
+		sep := ": "
+		if c.Children != nil && !c.ChildrenAsList {
+			sep = " "
+		}
+		if c.Name == "" {
+			sep = ""
+		}
+		children = append(children, c.Name+sep+formatValue(c))
+	}
+	if nd.ChildrenAsList {
+		return "[" + strings.Join(children, ", ") + "]"
+	}
+	if len(children) == 0 {
+		return "{}"
+	}
+	return "{ " + strings.Join(children, " ") + " }"
+}
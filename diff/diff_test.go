@@ -0,0 +1,245 @@
+package diff_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/diff"
+	"github.com/protocolbuffers/txtpbfmt/parser"
+	"github.com/protocolbuffers/txtpbfmt/query"
+)
+
+func TestDiff(t *testing.T) {
+	inputs := []struct {
+		name string
+		a    string
+		b    string
+		opts []diff.Option
+		want []string
+	}{{
+		name: "equal ignoring comments and formatting",
+		a: `# Comment.
+a: 1
+b { c: "x" }
+d: [1, 2]
+`,
+		b: `b <
+  c: 'x'  # Inline.
+>
+d: 1
+d: 2
+a: 1
+`,
+		want: nil,
+	}, {
+		name: "singular fields",
+		a: `a: 1
+b { c: 2 d: 3 }
+e: "x"
+`,
+		b: `a: 2
+b { c: 2 f: 4 }
+g { h: 1 }
+`,
+		want: []string{
+			`~ a: 1 -> 2`,
+			`- b.d: 3`,
+			`+ b.f: 4`,
+			`- e: "x"`,
+			`+ g: { h: 1 }`,
+		},
+	}, {
+		name: "scalar to message",
+		a:    "a: 1\n",
+		b:    "a {}\n",
+		want: []string{`~ a: 1 -> {}`},
+	}, {
+		name: "repeated insertion",
+		a: `a: 1
+a: 2
+a: 3
+`,
+		b: `a: 1
+a: 5
+a: 2
+a: 3
+`,
+		want: []string{`+ a[1]: 5`},
+	}, {
+		name: "repeated changes and removal",
+		a: `job { name: "x" cpu: 1 }
+job { name: "y" cpu: 2 }
+job { name: "z" cpu: 3 }
+`,
+		b: `job { name: "x" cpu: 4 }
+job { name: "z" cpu: 3 }
+`,
+		want: []string{
+			`~ job[0].cpu: 1 -> 4`,
+			`- job[1]: { name: "y" cpu: 2 }`,
+		},
+	}, {
+		name: "list values",
+		a:    `tags: ["a", "b", "c"]`,
+		b:    `tags: ["a", "c", "d"]`,
+		want: []string{
+			`- tags: "b"`,
+			`+ tags: "d"`,
+		},
+	}, {
+		name: "list of messages",
+		a: `job { name: "x" }
+job: [{ name: "y" }, { name: "z" }]
+`,
+		b: `job { name: "x" }
+job: [{ name: "w" }, { name: "z" }, { name: "v" }]
+`,
+		want: []string{
+			`~ job[1].*[0].name: "y" -> "w"`,
+			`+ job[1].*[2]: { name: "v" }`,
+		},
+	}, {
+		name: "reordering without key",
+		a: `job { name: "x" cpu: 1 }
+job { name: "y" cpu: 2 }
+`,
+		b: `job { name: "y" cpu: 2 }
+job { name: "x" cpu: 1 }
+`,
+		want: []string{
+			`- job[0]: { name: "x" cpu: 1 }`,
+			`+ job[1]: { name: "x" cpu: 1 }`,
+		},
+	}, {
+		name: "reordering with key",
+		a: `job { name: "x" cpu: 1 }
+job { name: "y" cpu: 2 }
+job { name: "z" cpu: 3 }
+job { cpu: 5 }
+`,
+		b: `job { name: "w" cpu: 0 }
+job { name: "y" cpu: 2 }
+job { name: "x" cpu: 4 }
+job { cpu: 6 }
+`,
+		opts: []diff.Option{diff.KeyBySubfield("job.name")},
+		want: []string{
+			`~ job[0].cpu: 1 -> 4`,
+			`- job[2]: { name: "z" cpu: 3 }`,
+			`+ job[0]: { name: "w" cpu: 0 }`,
+			`~ job[3].cpu: 5 -> 6`,
+		},
+	}, {
+		name: "key with subfield path",
+		a: `task { spec { id: 1 } size: 1 }
+task { spec { id: 2 } size: 2 }
+`,
+		b: `task { spec { id: 2 } size: 3 }
+task { spec { id: 1 } size: 1 }
+`,
+		opts: []diff.Option{diff.KeyBySubfield("job.name"), diff.KeyBySubfield("task.spec.id")},
+		want: []string{
+			`~ task[1].size: 2 -> 3`,
+		},
+	}, {
+		name: "key for all fields",
+		a: `a { id: 1 x: 1 }
+a { id: 2 }
+b { id: 1 }
+b { id: 2 x: 1 }
+`,
+		b: `a { id: 2 }
+a { id: 1 x: 2 }
+b { id: 2 x: 3 }
+b { id: 1 }
+`,
+		opts: []diff.Option{diff.KeyBySubfield("id")},
+		want: []string{
+			`~ a[0].x: 1 -> 2`,
+			`~ b[1].x: 1 -> 3`,
+		},
+	}, {
+		name: "nested repeated",
+		a: `job {
+  task { id: 1 }
+  task { id: 2 }
+}
+`,
+		b: `job {
+  task { id: 1 }
+  task { id: 3 }
+  [com.ext] { x: 1 }
+}
+`,
+		want: []string{
+			`~ job.task[1].id: 2 -> 3`,
+			`+ job.[com.ext]: { x: 1 }`,
+		},
+	}}
+	for _, input := range inputs {
+		a, err := parser.Parse([]byte(input.a))
+		if err != nil {
+			t.Fatalf("%s: Parse(%q) returned err %v", input.name, input.a, err)
+		}
+		b, err := parser.Parse([]byte(input.b))
+		if err != nil {
+			t.Fatalf("%s: Parse(%q) returned err %v", input.name, input.b, err)
+		}
+		var got []string
+		for _, c := range diff.Diff(a, b, input.opts...) {
+			got = append(got, c.String())
+			checkPath(t, input.name, c, a, b)
+		}
+		if diff := cmp.Diff(input.want, got); diff != "" {
+			t.Errorf("%s: Diff returned diff (-want, +got):\n%s", input.name, diff)
+		}
+	}
+}
+
+// checkPath checks that the path of c resolves to the changed node, or to the list holding the
+// changed value.
+func checkPath(t *testing.T, name string, c diff.Change, a, b []*ast.Node) {
+	t.Helper()
+	nd, tree := c.Old, a
+	if c.Kind == diff.Added {
+		nd, tree = c.New, b
+	}
+	got := query.MustCompile(c.Path).Nodes(tree)
+	if len(got) != 1 {
+		t.Errorf("%s: path %q of %v resolves to %d nodes, want 1", name, c.Path, c, len(got))
+		return
+	}
+	if got[0] != nd && !(got[0].ValuesAsList && len(nd.Values) == 1 && containsValue(got[0].Values, nd.Values[0])) {
+		t.Errorf("%s: path %q of %v resolves to %v, want %v", name, c.Path, c, got[0], nd)
+	}
+}
+
+func containsValue(values []*ast.Value, v *ast.Value) bool {
+	for _, w := range values {
+		if w == v {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDiffNodes(t *testing.T) {
+	a, err := parser.Parse([]byte("a: 1\nb: 2\n"))
+	if err != nil {
+		t.Fatalf("Parse returned err %v", err)
+	}
+	b, err := parser.Parse([]byte("a: 3\nc: 4\n"))
+	if err != nil {
+		t.Fatalf("Parse returned err %v", err)
+	}
+	changes := diff.Diff(a, b)
+	want := []diff.Change{
+		{Kind: diff.Changed, Path: "a", Old: a[0], New: b[0]},
+		{Kind: diff.Removed, Path: "b", Old: a[1]},
+		{Kind: diff.Added, Path: "c", New: b[1]},
+	}
+	if diff := cmp.Diff(want, changes); diff != "" {
+		t.Errorf("Diff returned diff (-want, +got):\n%s", diff)
+	}
+}
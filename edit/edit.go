@@ -0,0 +1,322 @@
+// Package edit provides functions to edit the parse tree by path, preserving comments.
+//
+// Paths are queries as described in the query package, e.g. `job[name="foo"].task[0].cpu`. The
+// functions take the top-level nodes and return them after the edit, since adding or removing
+// top-level fields changes the slice; use them like append:
+//
+//	nodes, err = edit.Set(nodes, "job.task.cpu", &ast.Value{Value: "2"})
+package edit
+
+import (
+	"fmt"
+
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/query"
+)
+
+// End is the position for inserting nodes after the last field.
+const End = -1
+
+// Set sets the values of the fields matched by path. If no field matches, the field is created
+// along with any missing messages on the way, within all the messages matched by the longest
+// matching prefix of path; the steps after that prefix must be plain field names.
+//
+// The comments of existing fields are kept. More than one value results in a list.
+func Set(nodes []*ast.Node, path string, values ...*ast.Value) ([]*ast.Node, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no values to set at %q", path)
+	}
+	q, err := query.Compile(path)
+	if err != nil {
+		return nil, err
+	}
+	root := &ast.Node{Children: nodes}
+	if matched := q.Nodes(nodes); len(matched) > 0 {
+		for _, nd := range matched {
+			if nd.Children != nil {
+				return nil, fmt.Errorf("field %q matched by %q is a message", nd.Name, path)
+			}
+		}
+		for _, nd := range matched {
+			setValues(nd, values)
+		}
+		fix(root, matched...)
+		return root.Children, nil
+	}
+	parents, names, err := missing(root, q)
+	if err != nil {
+		return nil, err
+	}
+	var created []*ast.Node
+	for _, parent := range parents {
+		parent = ensureMessages(parent, names[:len(names)-1])
+		nd := &ast.Node{Name: names[len(names)-1]}
+		setValues(nd, values)
+		insert(parent, nd, End)
+		created = append(created, nd)
+	}
+	fix(root, created...)
+	return root.Children, nil
+}
+
+// Insert inserts nd into the message matched by parentPath, before the field at the given index
+// among its fields, or after the last field for End. The comments before that field stay attached
+// to it, and comments after the last field stay last. An empty parentPath inserts at the top level.
+//
+// If no message matches parentPath it is created as in Set. If more than one message matches, an
+// error is returned.
+func Insert(nodes []*ast.Node, parentPath string, nd *ast.Node, position int) ([]*ast.Node, error) {
+	root := &ast.Node{Children: nodes}
+	parent, err := message(root, parentPath)
+	if err != nil {
+		return nil, err
+	}
+	insert(parent, nd, position)
+	fix(root, nd)
+	return root.Children, nil
+}
+
+// Delete removes the fields matched by path along with their comments. If the removed field was
+// separated from the previous one by an empty line, the empty line is kept. Nothing is removed if
+// no field matches.
+func Delete(nodes []*ast.Node, path string) ([]*ast.Node, error) {
+	q, err := query.Compile(path)
+	if err != nil {
+		return nil, err
+	}
+	root := &ast.Node{Children: nodes}
+	for _, nd := range q.Nodes(nodes) {
+		remove(root, nd)
+	}
+	return root.Children, nil
+}
+
+// Move moves the fields matched by from, along with their comments, into the message matched by
+// to, as Insert does. The fields keep their order. Nothing is moved if no field matches from.
+func Move(nodes []*ast.Node, from, to string, position int) ([]*ast.Node, error) {
+	q, err := query.Compile(from)
+	if err != nil {
+		return nil, err
+	}
+	root := &ast.Node{Children: nodes}
+	moved := q.Nodes(nodes)
+	if len(moved) == 0 {
+		return nodes, nil
+	}
+	// Check the destination before creating missing messages, so that errors leave nodes unchanged.
+	parent, names, err := findMessage(root, to)
+	if err != nil {
+		return nil, err
+	}
+	for _, nd := range moved {
+		if nd == parent || contains(nd.Children, parent) {
+			return nil, fmt.Errorf("can't move field %q matched by %q into itself", nd.Name, from)
+		}
+	}
+	parent = ensureMessages(parent, names)
+	for _, nd := range moved {
+		remove(root, nd)
+	}
+	for _, nd := range moved {
+		insert(parent, nd, position)
+		if position != End {
+			position++
+		}
+	}
+	fix(root, moved...)
+	return root.Children, nil
+}
+
+// message returns the message matched by path, creating it if there is none. root holds the
+// top-level nodes, and is returned for an empty path.
+func message(root *ast.Node, path string) (*ast.Node, error) {
+	parent, names, err := findMessage(root, path)
+	if err != nil {
+		return nil, err
+	}
+	return ensureMessages(parent, names), nil
+}
+
+// findMessage returns the message matched by path without changing root. If there is none, it
+// returns the message in which message creates the missing messages of the given names instead.
+func findMessage(root *ast.Node, path string) (*ast.Node, []string, error) {
+	if path == "" {
+		return root, nil, nil
+	}
+	q, err := query.Compile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	matched := q.Nodes(root.Children)
+	if len(matched) > 1 {
+		return nil, nil, fmt.Errorf("%q matches %d fields, want one", path, len(matched))
+	}
+	if len(matched) == 1 {
+		if len(matched[0].Values) > 0 {
+			return nil, nil, fmt.Errorf("field %q matched by %q isn't a message", matched[0].Name, path)
+		}
+		return matched[0], nil, nil
+	}
+	parents, names, err := missing(root, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(parents) > 1 {
+		return nil, nil, fmt.Errorf("%q would be created in %d messages, want one", path, len(parents))
+	}
+	return parents[0], names, nil
+}
+
+// missing returns the messages matched by the longest prefix of q that matches any, and the names
+// of the fields of the remaining steps.
+func missing(root *ast.Node, q *query.Query) ([]*ast.Node, []string, error) {
+	n := q.Len() - 1
+	parents := []*ast.Node{root}
+	for ; n > 0; n-- {
+		if matched := q.Prefix(n).Nodes(root.Children); len(matched) > 0 {
+			parents = matched
+			break
+		}
+	}
+	var names []string
+	for i := n; i < q.Len(); i++ {
+		name, ok := q.FieldName(i)
+		if !ok {
+			return nil, nil, fmt.Errorf("no field matches %q, and %q can't be created", q, q.Prefix(i+1))
+		}
+		names = append(names, name)
+	}
+	for _, p := range parents {
+		if p != root && len(p.Values) > 0 {
+			return nil, nil, fmt.Errorf("field %q matched by %q isn't a message", p.Name, q.Prefix(n))
+		}
+	}
+	return parents, names, nil
+}
+
+// ensureMessages returns the message at the path of names below parent, creating missing messages.
+func ensureMessages(parent *ast.Node, names []string) *ast.Node {
+	for _, name := range names {
+		var next *ast.Node
+		for _, c := range parent.Children {
+			if c.Name == name && !c.Deleted && len(c.Values) == 0 {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			next = &ast.Node{Name: name, Children: []*ast.Node{}, SkipColon: true}
+			insert(parent, next, End)
+		}
+		parent = next
+	}
+	return parent
+}
+
+// setValues sets copies of values as the values of nd, keeping the comment after the last value.
+func setValues(nd *ast.Node, values []*ast.Value) {
+	var comment string
+	if len(nd.Values) > 0 {
+		comment = nd.Values[len(nd.Values)-1].InlineComment
+	}
+	nd.Values = nil
+	for _, v := range values {
+		nd.Values = append(nd.Values, v.Clone())
+	}
+	if last := nd.Values[len(nd.Values)-1]; last.InlineComment == "" {
+		last.InlineComment = comment
+	}
+	if len(values) > 1 && !nd.ValuesAsList {
+		// Lists that didn't exist before are kept on one line.
+		nd.ValuesAsList = true
+		nd.ChildrenSameLine = true
+	}
+}
+
+// insert inserts nd into the children of parent before the field at the given index, or after the
+// last field for End. If the field after nd, or the last field when appending, is preceded by an
+// empty line, nd is too.
+func insert(parent *ast.Node, nd *ast.Node, position int) {
+	var fields []int
+	for i, c := range parent.Children {
+		if !c.IsCommentOnly() && !c.Deleted {
+			fields = append(fields, i)
+		}
+	}
+	i := len(parent.Children)
+	var neighbor *ast.Node
+	switch {
+	case position >= 0 && position < len(fields):
+		i = fields[position]
+		neighbor = parent.Children[i]
+	case len(fields) > 0:
+		i = fields[len(fields)-1] + 1
+		neighbor = parent.Children[i-1]
+	}
+	if neighbor != nil && startsWithEmptyLine(neighbor) && !startsWithEmptyLine(nd) {
+		nd.PreComments = append([]string{""}, nd.PreComments...)
+	}
+	parent.Children = append(parent.Children, nil)
+	copy(parent.Children[i+1:], parent.Children[i:])
+	parent.Children[i] = nd
+}
+
+// remove removes nd from the children of its parent below root, moving a preceding empty line to
+// the next node.
+func remove(root *ast.Node, nd *ast.Node) {
+	parent := parentOf(root, nd)
+	if parent == nil {
+		return
+	}
+	for i, c := range parent.Children {
+		if c != nd {
+			continue
+		}
+		parent.Children = append(parent.Children[:i:i], parent.Children[i+1:]...)
+		if i < len(parent.Children) && startsWithEmptyLine(nd) && !startsWithEmptyLine(parent.Children[i]) {
+			next := parent.Children[i]
+			next.PreComments = append([]string{""}, next.PreComments...)
+		}
+		return
+	}
+}
+
+func startsWithEmptyLine(nd *ast.Node) bool {
+	return len(nd.PreComments) > 0 && nd.PreComments[0] == ""
+}
+
+// parentOf returns the node whose children include nd, or nil.
+func parentOf(parent *ast.Node, nd *ast.Node) *ast.Node {
+	for _, c := range parent.Children {
+		if c == nd {
+			return parent
+		}
+		if p := parentOf(c, nd); p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+// contains reports whether nd is one of nodes or their descendants.
+func contains(nodes []*ast.Node, nd *ast.Node) bool {
+	for _, c := range nodes {
+		if c == nd || contains(c.Children, nd) {
+			return true
+		}
+	}
+	return false
+}
+
+// fix makes the top-level nodes containing the edited nodes consistent, e.g. by expanding messages
+// that had all children on the same line if an edited node spans several lines.
+func fix(root *ast.Node, edited ...*ast.Node) {
+	for _, top := range root.Children {
+		for _, nd := range edited {
+			if top == nd || contains(top.Children, nd) {
+				top.Fix()
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package edit_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kylelemons/godebug/diff"
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/edit"
+	"github.com/protocolbuffers/txtpbfmt/parser"
+)
+
+const content = `# File comment.
+
+job {
+  name: "foo"  # The name.
+  task { id: 1 }
+}
+
+# Second job.
+job {
+  name: "bar"
+}
+`
+
+func TestEdit(t *testing.T) {
+	inputs := []struct {
+		name string
+		edit func(nodes []*ast.Node) ([]*ast.Node, error)
+		out  string
+	}{{
+		name: "set existing field keeps comment",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Set(nodes, `job[0].name`, &ast.Value{Value: `"baz"`})
+		},
+		out: `# File comment.
+
+job {
+  name: "baz"  # The name.
+  task { id: 1 }
+}
+
+# Second job.
+job {
+  name: "bar"
+}
+`,
+	}, {
+		name: "set creates field in all matched messages",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Set(nodes, `job.priority`, &ast.Value{Value: "HIGH"})
+		},
+		out: `# File comment.
+
+job {
+  name: "foo"  # The name.
+  task { id: 1 }
+  priority: HIGH
+}
+
+# Second job.
+job {
+  name: "bar"
+  priority: HIGH
+}
+`,
+	}, {
+		name: "set creates intermediate messages",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Set(nodes, `job[name="bar"].task.resources.cpu`, &ast.Value{Value: "2"})
+		},
+		out: `# File comment.
+
+job {
+  name: "foo"  # The name.
+  task { id: 1 }
+}
+
+# Second job.
+job {
+  name: "bar"
+  task {
+    resources {
+      cpu: 2
+    }
+  }
+}
+`,
+	}, {
+		name: "set within single-line message",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Set(nodes, `job.task.cpu`, &ast.Value{Value: "2"})
+		},
+		out: `# File comment.
+
+job {
+  name: "foo"  # The name.
+  task { id: 1 cpu: 2 }
+}
+
+# Second job.
+job {
+  name: "bar"
+}
+`,
+	}, {
+		name: "set list at top level",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Set(nodes, `tags`, &ast.Value{Value: `"a"`}, &ast.Value{Value: `"b"`})
+		},
+		out: `# File comment.
+
+job {
+  name: "foo"  # The name.
+  task { id: 1 }
+}
+
+# Second job.
+job {
+  name: "bar"
+}
+
+tags: ["a", "b"]
+`,
+	}, {
+		name: "insert before field keeps its comments",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Insert(nodes, "", &ast.Node{Name: "version", Values: []*ast.Value{{Value: "2"}}}, 1)
+		},
+		out: `# File comment.
+
+job {
+  name: "foo"  # The name.
+  task { id: 1 }
+}
+
+version: 2
+
+# Second job.
+job {
+  name: "bar"
+}
+`,
+	}, {
+		name: "insert with comment expands single-line message",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			nd := &ast.Node{Name: "id", PreComments: []string{"# New id."}, Values: []*ast.Value{{Value: "0"}}}
+			return edit.Insert(nodes, "job[0].task", nd, 0)
+		},
+		out: `# File comment.
+
+job {
+  name: "foo"  # The name.
+  task {
+    # New id.
+    id: 0
+    id: 1
+  }
+}
+
+# Second job.
+job {
+  name: "bar"
+}
+`,
+	}, {
+		name: "delete keeps empty line",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Delete(nodes, `job[name="foo"]`)
+		},
+		out: `# File comment.
+
+# Second job.
+job {
+  name: "bar"
+}
+`,
+	}, {
+		name: "delete without match",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Delete(nodes, `job.missing`)
+		},
+		out: content,
+	}, {
+		name: "move with comments",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Move(nodes, `job[0].name`, `job[1]`, 0)
+		},
+		out: `# File comment.
+
+job {
+  task { id: 1 }
+}
+
+# Second job.
+job {
+  name: "foo"  # The name.
+  name: "bar"
+}
+`,
+	}, {
+		name: "move to new message",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Move(nodes, `job.task`, `archive`, edit.End)
+		},
+		out: `# File comment.
+
+job {
+  name: "foo"  # The name.
+}
+
+# Second job.
+job {
+  name: "bar"
+}
+
+archive {
+  task { id: 1 }
+}
+`,
+	}}
+	for _, input := range inputs {
+		nodes, err := parser.Parse([]byte(content))
+		if err != nil {
+			t.Fatalf("Parse returned err %v", err)
+		}
+		nodes, err = input.edit(nodes)
+		if err != nil {
+			t.Errorf("%s: returned err %v", input.name, err)
+			continue
+		}
+		if diff := diff.Diff(input.out, parser.Pretty(nodes, 0)); diff != "" {
+			t.Errorf("%s: returned diff (-want, +got):\n%s", input.name, diff)
+		}
+	}
+}
+
+func TestEditErrors(t *testing.T) {
+	inputs := []struct {
+		name string
+		edit func(nodes []*ast.Node) ([]*ast.Node, error)
+		err  string
+	}{{
+		name: "set message",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Set(nodes, `job`, &ast.Value{Value: "1"})
+		},
+		err: "is a message",
+	}, {
+		name: "set without values",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Set(nodes, `job.name`)
+		},
+		err: "no values",
+	}, {
+		name: "set below scalar",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Set(nodes, `job.name.x`, &ast.Value{Value: "1"})
+		},
+		err: "isn't a message",
+	}, {
+		name: "set with selector on missing field",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Set(nodes, `job.missing[0].x`, &ast.Value{Value: "1"})
+		},
+		err: "can't be created",
+	}, {
+		name: "insert into several messages",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Insert(nodes, `job`, &ast.Node{Name: "x"}, edit.End)
+		},
+		err: "matches 2 fields",
+	}, {
+		name: "move into itself",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Move(nodes, `job[0]`, `job[0].task`, edit.End)
+		},
+		err: "into itself",
+	}, {
+		name: "move into new message of itself",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Move(nodes, `job[0]`, `job[0].archive`, edit.End)
+		},
+		err: "into itself",
+	}, {
+		name: "invalid path",
+		edit: func(nodes []*ast.Node) ([]*ast.Node, error) {
+			return edit.Delete(nodes, `job[`)
+		},
+		err: "invalid query",
+	}}
+	for _, input := range inputs {
+		nodes, err := parser.Parse([]byte(content))
+		if err != nil {
+			t.Fatalf("Parse returned err %v", err)
+		}
+		want := parser.Pretty(nodes, 0)
+		if _, err := input.edit(nodes); err == nil || !strings.Contains(err.Error(), input.err) {
+			t.Errorf("%s: returned err %v, want error containing %q", input.name, err, input.err)
+		}
+		if diff := diff.Diff(want, parser.Pretty(nodes, 0)); diff != "" {
+			t.Errorf("%s: changed the nodes (-want, +got):\n%s", input.name, diff)
+		}
+	}
+}
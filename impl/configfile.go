@@ -0,0 +1,173 @@
+package impl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/config"
+	"github.com/protocolbuffers/txtpbfmt/unquote"
+)
+
+// ConfigFileName is the name of the files that hold the configuration for all files in their
+// directory and its subdirectories.
+//
+// A config file is a textproto whose fields are MetaComment keys, e.g.
+//
+//	# Don't look for config files in parent directories.
+//	root: true
+//	wrap_strings_at_column: 80
+//	sort_repeated_fields_by_subfield: "job.name"
+//	section {
+//	  glob: "*_test.textproto"
+//	  expand_all_children: false
+//	}
+//
+// Each section only applies to the files matching its glob, relative to the config file's
+// directory. Globs without a '/' are matched against the file's base name.
+const ConfigFileName = ".txtpbfmt"
+
+// AddConfigFilesToConfig finds the config files that apply to the file at path, by walking up from
+// its directory until the filesystem root or a config file with "root: true", and adds their
+// settings to the configuration. Settings of config files closer to the file take precedence.
+// MetaComments in the file itself are not processed.
+func AddConfigFilesToConfig(path string, c *config.Config) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	type configFile struct {
+		path  string
+		nodes []*ast.Node
+	}
+	var files []configFile
+	for dir := filepath.Dir(abs); ; {
+		cfPath := filepath.Join(dir, ConfigFileName)
+		in, err := os.ReadFile(cfPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			nodes, err := Parse(in)
+			if err != nil {
+				return fmt.Errorf("error parsing %s: %w", cfPath, err)
+			}
+			files = append(files, configFile{cfPath, nodes})
+			if isRootConfigFile(nodes) {
+				break
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	// Apply the outermost config file first.
+	for i := len(files) - 1; i >= 0; i-- {
+		rel, err := filepath.Rel(filepath.Dir(files[i].path), abs)
+		if err != nil {
+			return err
+		}
+		if err := addConfigNodesToConfig(files[i].nodes, filepath.ToSlash(rel), c); err != nil {
+			return fmt.Errorf("error in %s: %v", files[i].path, err)
+		}
+	}
+	return nil
+}
+
+// AddConfigFileToConfig adds the settings of the config file with the given content to the
+// configuration, for a file at relPath relative to the config file's directory.
+func AddConfigFileToConfig(in []byte, relPath string, c *config.Config) error {
+	nodes, err := Parse(in)
+	if err != nil {
+		return err
+	}
+	return addConfigNodesToConfig(nodes, filepath.ToSlash(relPath), c)
+}
+
+func isRootConfigFile(nodes []*ast.Node) bool {
+	for _, nd := range nodes {
+		if nd.Name == "root" && len(nd.Values) == 1 && nd.Values[0].Value == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// addConfigNodesToConfig applies the top-level settings, and then the matching sections in order.
+func addConfigNodesToConfig(nodes []*ast.Node, relPath string, c *config.Config) error {
+	var sections []*ast.Node
+	for _, nd := range nodes {
+		switch {
+		case nd.IsCommentOnly() || nd.Name == "root":
+		case nd.Name == "section":
+			sections = append(sections, nd)
+		default:
+			if err := addConfigNodeToConfig(nd, c); err != nil {
+				return err
+			}
+		}
+	}
+	for _, s := range sections {
+		matched, err := sectionMatches(s, relPath)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+		for _, nd := range s.Children {
+			if nd.IsCommentOnly() || nd.Name == "glob" {
+				continue
+			}
+			if err := addConfigNodeToConfig(nd, c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func sectionMatches(s *ast.Node, relPath string) (bool, error) {
+	globs := ast.GetFromPath(s.Children, []string{"glob"})
+	if len(globs) == 0 {
+		return false, fmt.Errorf("section at line %d has no glob", s.Start.Line)
+	}
+	for _, g := range globs {
+		glob, _, err := unquote.Unquote(g)
+		if err != nil {
+			return false, fmt.Errorf("invalid glob at line %d: %v", g.Start.Line, err)
+		}
+		name := relPath
+		if !strings.Contains(glob, "/") {
+			name = filepath.Base(relPath)
+		}
+		matched, err := filepath.Match(glob, name)
+		if err != nil {
+			return false, fmt.Errorf("invalid glob %q at line %d: %v", glob, g.Start.Line, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// addConfigNodeToConfig converts a config file field to the equivalent MetaComment.
+func addConfigNodeToConfig(nd *ast.Node, c *config.Config) error {
+	if len(nd.Values) != 1 {
+		return fmt.Errorf("field %q at line %d should have a single scalar value", nd.Name, nd.Start.Line)
+	}
+	val := nd.Values[0].Value
+	if strings.HasPrefix(val, `"`) || strings.HasPrefix(val, `'`) {
+		s, _, err := unquote.Unquote(nd)
+		if err != nil {
+			return fmt.Errorf("invalid string for field %q at line %d: %v", nd.Name, nd.Start.Line, err)
+		}
+		val = s
+	}
+	return addToConfig(nd.Name+"="+val, c)
+}
@@ -0,0 +1,150 @@
+package impl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/protocolbuffers/txtpbfmt/config"
+)
+
+func TestAddConfigFileToConfig(t *testing.T) {
+	inputs := []struct {
+		name    string
+		in      string
+		relPath string
+		want    config.Config
+		wantErr string
+	}{{
+		name: "top-level settings",
+		in: `# comment
+wrap_strings_at_column: 80
+expand_all_children: true
+sort_repeated_fields_by_subfield: "job.name"
+sort_repeated_fields_by_subfield: 'task.id'
+`,
+		relPath: "a.textproto",
+		want: config.Config{
+			WrapStringsAtColumn:          80,
+			ExpandAllChildren:            true,
+			SortRepeatedFieldsBySubfield: []string{"job.name", "task.id"},
+		},
+	}, {
+		name: "matching sections are applied in order",
+		in: `expand_all_children: true
+section {
+  glob: "*_test.textproto"
+  expand_all_children: false
+  wrap_strings_at_column: 40
+}
+section {
+  glob: "sub/*"
+  wrap_strings_at_column: 60
+}
+section {
+  glob: "other/*"
+  smartquotes: true
+}
+`,
+		relPath: "sub/a_test.textproto",
+		want: config.Config{
+			WrapStringsAtColumn: 60,
+		},
+	}, {
+		name:    "section without glob",
+		in:      `section { disable: true }`,
+		relPath: "a.textproto",
+		wantErr: "no glob",
+	}, {
+		name:    "unknown setting",
+		in:      `not_a_setting: true`,
+		relPath: "a.textproto",
+		wantErr: "unrecognized MetaComment",
+	}, {
+		name:    "invalid bool",
+		in:      `disable: maybe`,
+		relPath: "a.textproto",
+		wantErr: "error parsing disable",
+	}}
+	for _, input := range inputs {
+		var got config.Config
+		err := AddConfigFileToConfig([]byte(input.in), input.relPath, &got)
+		if input.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), input.wantErr) {
+				t.Errorf("AddConfigFileToConfig[%s] got err=%v, want err=%v", input.name, err, input.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("AddConfigFileToConfig[%s] returned err %v", input.name, err)
+			continue
+		}
+		if diff := cmp.Diff(input.want, got, cmpopts.IgnoreFields(config.Config{}, "Logger")); diff != "" {
+			t.Errorf("AddConfigFileToConfig[%s] returned diff (-want, +got):\n%s", input.name, diff)
+		}
+	}
+}
+
+func TestAddConfigFilesToConfig(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"outer/" + ConfigFileName:                "skip_all_colons: true\n",
+		"outer/project/" + ConfigFileName:        "root: true\nwrap_strings_at_column: 80\nsmartquotes: true\n",
+		"outer/project/sub/" + ConfigFileName:    "wrap_strings_at_column: 100\nsection { glob: \"b.textproto\" smartquotes: false }\n",
+		"outer/project/sub/a.textproto":          "",
+		"outer/project/sub/b.textproto":          "",
+		"outer/project/other/c.textproto":        "",
+		"outer/unrooted/d.textproto":             "",
+		"outer/project/broken/" + ConfigFileName: "wrap_strings_at_column: \"80\n",
+		"outer/project/broken/e.textproto":       "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inputs := []struct {
+		path    string
+		want    config.Config
+		wantErr bool
+	}{{
+		path: "outer/project/sub/a.textproto",
+		want: config.Config{WrapStringsAtColumn: 100, SmartQuotes: true},
+	}, {
+		path: "outer/project/sub/b.textproto",
+		want: config.Config{WrapStringsAtColumn: 100},
+	}, {
+		path: "outer/project/other/c.textproto",
+		want: config.Config{WrapStringsAtColumn: 80, SmartQuotes: true},
+	}, {
+		path: "outer/unrooted/d.textproto",
+		want: config.Config{SkipAllColons: true},
+	}, {
+		path:    "outer/project/broken/e.textproto",
+		wantErr: true,
+	}}
+	for _, input := range inputs {
+		var got config.Config
+		err := AddConfigFilesToConfig(filepath.Join(dir, input.path), &got)
+		if input.wantErr {
+			if err == nil {
+				t.Errorf("AddConfigFilesToConfig[%s] got err=nil, want error", input.path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("AddConfigFilesToConfig[%s] returned err %v", input.path, err)
+			continue
+		}
+		if diff := cmp.Diff(input.want, got, cmpopts.IgnoreFields(config.Config{}, "Logger")); diff != "" {
+			t.Errorf("AddConfigFilesToConfig[%s] returned diff (-want, +got):\n%s", input.path, diff)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package impl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/protocolbuffers/txtpbfmt/ast"
+)
+
+// ErrorCode categorizes a ParseError.
+type ErrorCode int
+
+const (
+	// UnexpectedInput is reported for input that can't start or continue a field.
+	UnexpectedInput ErrorCode = iota
+	// UnterminatedString is reported for a string literal that is missing its closing quote.
+	UnterminatedString
+	// NewlineInString is reported for a literal (unescaped) newline in a string.
+	NewlineInString
+	// MissingFieldName is reported for an unnamed field where names are required.
+	MissingFieldName
+	// UnbalancedBracket is reported for a closing bracket without a matching opening bracket.
+	UnbalancedBracket
+	// MultipleStringValues is reported for adjacent strings without separator within a list.
+	MultipleStringValues
+	// LoopDetected is reported when the parser fails to make progress.
+	LoopDetected
+	// InvalidFormatterDirective is reported for a "# txtpbfmt: off" or "# txtpbfmt: on" directive
+	// that is not followed by a newline.
+	InvalidFormatterDirective
+	// UnterminatedFormatterOff is reported for a "# txtpbfmt: off" without "# txtpbfmt: on".
+	UnterminatedFormatterOff
+)
+
+var errorCodeNames = map[ErrorCode]string{
+	UnexpectedInput:           "unexpected input",
+	UnterminatedString:        "unterminated string",
+	NewlineInString:           "newline in string",
+	MissingFieldName:          "missing field name",
+	UnbalancedBracket:         "unbalanced bracket",
+	MultipleStringValues:      "multiple string values",
+	LoopDetected:              "loop detected",
+	InvalidFormatterDirective: "invalid formatter directive",
+	UnterminatedFormatterOff:  "unterminated txtpbfmt off",
+}
+
+func (c ErrorCode) String() string {
+	if name, ok := errorCodeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("ErrorCode(%d)", int(c))
+}
+
+// ParseError is returned for syntax errors in the input. Use errors.As to access it.
+type ParseError struct {
+	// Pos is the position at which the error was detected.
+	Pos ast.Position
+	// Code categorizes the error.
+	Code ErrorCode
+	// Msg describes the error, without position information.
+	Msg string
+	// Snippet is the line of input containing Pos, without the trailing newline.
+	Snippet string
+	// context describes the surrounding input for Error().
+	context string
+}
+
+func (e *ParseError) Error() string {
+	if e.context == "" {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s at %s", e.Msg, e.context)
+}
+
+// lineAt returns the line of in containing the byte at index i, without the trailing newline.
+func lineAt(in []byte, i int) string {
+	if i > len(in) {
+		i = len(in)
+	}
+	start := bytes.LastIndexByte(in[:i], '\n') + 1
+	end := bytes.IndexByte(in[i:], '\n')
+	if end < 0 {
+		return string(in[start:])
+	}
+	return string(in[start : i+end])
+}
+
+// errorf returns a ParseError at the current position.
+func (p *parser) errorf(code ErrorCode, format string, args ...any) error {
+	return &ParseError{
+		Pos:     p.position(),
+		Code:    code,
+		Msg:     fmt.Sprintf(format, args...),
+		Snippet: lineAt(p.in, p.index),
+		context: p.errorContext(),
+	}
+}
+
+// ParseErrors is returned by ParseWithRecovery, listing all syntax errors in the input in order.
+type ParseErrors []*ParseError
+
+func (e ParseErrors) Error() string {
+	var msgs []string
+	for _, err := range e {
+		msgs = append(msgs, fmt.Sprintf("%d:%d: %s", err.Pos.Line, err.Pos.Column, err.Msg))
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// recoverFrom records err and returns true if the parser recovers from syntax errors. Otherwise, or
+// if err isn't a syntax error, it returns false and err should be returned.
+func (p *parser) recoverFrom(err error) bool {
+	var pe *ParseError
+	if !p.recovering || !errors.As(err, &pe) {
+		return false
+	}
+	p.errs = append(p.errs, pe)
+	return true
+}
+
+// lineStart returns pos moved back to the start of its line if only whitespace precedes it there.
+func (p *parser) lineStart(pos ast.Position) ast.Position {
+	start := pos
+	for start.Byte > 0 && (p.in[start.Byte-1] == ' ' || p.in[start.Byte-1] == '\t') {
+		start.Byte--
+		start.Column--
+	}
+	if start.Byte == 0 || p.in[start.Byte-1] == '\n' {
+		return start
+	}
+	return pos
+}
+
+// invalidNode skips the input from start, which precedes the current position, up to the end of
+// the line with the current position, or further until the brackets opened in the skipped input are
+// closed. It stops before a closing bracket of an enclosing message or list. It returns a node
+// holding the skipped input.
+func (p *parser) invalidNode(start ast.Position, err error) *ast.Node {
+	errIndex := p.index
+	p.rollbackPosition(start)
+	depth := 0
+	state := bracketState{}
+	i := p.index
+scan:
+	for ; i < p.length; i++ {
+		c := p.in[i]
+		state.processChar(c, i, p.in, p.config.AllowTripleQuotedStrings)
+		switch c {
+		case '\n':
+			state.insideComment = false
+			if !state.insideTripleQuotedString {
+				state.insideString = false
+			}
+			if i >= errIndex && depth <= 0 {
+				i++
+				break scan
+			}
+		case '{', '<', '[':
+			if !state.insideComment && !state.insideString {
+				depth++
+			}
+		case '}', '>', ']':
+			if state.insideComment || state.insideString {
+				break
+			}
+			if depth > 0 {
+				depth--
+			} else if p.depth > 0 && i > p.index {
+				// Leave the bracket for the enclosing message or list.
+				break scan
+			}
+		}
+		if state.isEscapedChar {
+			state.isEscapedChar = false
+		} else if c == '\\' && state.insideString && !state.insideTripleQuotedString {
+			state.isEscapedChar = true
+		}
+	}
+	raw := p.advance(i)
+	msg := err.Error()
+	if pe := (*ParseError)(nil); errors.As(err, &pe) {
+		msg = pe.Msg
+	}
+	return &ast.Node{
+		Start:       start,
+		Raw:         raw,
+		SyntaxError: msg,
+		End:         p.position(),
+		FieldStart:  start,
+		FieldEnd:    p.position(),
+	}
+}
@@ -0,0 +1,85 @@
+package impl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/config"
+)
+
+func TestParseError(t *testing.T) {
+	inputs := []struct {
+		name        string
+		in          string
+		wantCode    ErrorCode
+		wantPos     ast.Position
+		wantSnippet string
+	}{{
+		name:        "too many closing brackets",
+		in:          "a: 1\nb {}}\n",
+		wantCode:    UnbalancedBracket,
+		wantPos:     ast.Position{Byte: 9, Line: 2, Column: 5},
+		wantSnippet: "b {}}",
+	}, {
+		name:        "unterminated string",
+		in:          "a: 1\nb: \"abc\n",
+		wantCode:    UnterminatedString,
+		wantPos:     ast.Position{Byte: 8, Line: 2, Column: 4},
+		wantSnippet: `b: "abc`,
+	}, {
+		name:        "unterminated triple-quoted string",
+		in:          "a: 1\nb: '''abc\n",
+		wantCode:    UnterminatedString,
+		wantPos:     ast.Position{Byte: 8, Line: 2, Column: 4},
+		wantSnippet: "b: '''abc",
+	}, {
+		name:        "newline in string",
+		in:          "a: {\n  b: \"x\ny\"\n}\n",
+		wantCode:    NewlineInString,
+		wantPos:     ast.Position{Byte: 12, Line: 2, Column: 8},
+		wantSnippet: `  b: "x`,
+	}, {
+		name:        "missing field name",
+		in:          "a {\n  {}\n}\n",
+		wantCode:    MissingFieldName,
+		wantPos:     ast.Position{Byte: 6, Line: 2, Column: 3},
+		wantSnippet: "  {}",
+	}, {
+		name:        "multiple string values",
+		in:          `a: ["a" "b"]`,
+		wantCode:    MultipleStringValues,
+		wantPos:     ast.Position{Byte: 11, Line: 1, Column: 12},
+		wantSnippet: `a: ["a" "b"]`,
+	}, {
+		name:        "unterminated txtpbfmt off",
+		in:          "# txtpbfmt: off\na: 1\n",
+		wantCode:    UnterminatedFormatterOff,
+		wantPos:     ast.Position{Byte: 0, Line: 1, Column: 1},
+		wantSnippet: "# txtpbfmt: off",
+	}, {
+		name:        "invalid txtpbfmt off",
+		in:          "a: 1\n# txtpbfmt: off x\n",
+		wantCode:    InvalidFormatterDirective,
+		wantPos:     ast.Position{Byte: 20, Line: 2, Column: 16},
+		wantSnippet: "# txtpbfmt: off x",
+	}, {
+		name:        "unexpected colon",
+		in:          "a: 1 b:: 2\n",
+		wantCode:    UnexpectedInput,
+		wantPos:     ast.Position{Byte: 8, Line: 1, Column: 9},
+		wantSnippet: "a: 1 b:: 2",
+	}}
+	for _, input := range inputs {
+		_, err := ParseWithConfig([]byte(input.in), config.Config{AllowTripleQuotedStrings: true})
+		var pe *ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("ParseWithConfig[%s] returned err %v, want a *ParseError", input.name, err)
+			continue
+		}
+		if pe.Code != input.wantCode || pe.Pos != input.wantPos || pe.Snippet != input.wantSnippet {
+			t.Errorf("ParseWithConfig[%s] returned %v at %+v with snippet %q, want %v at %+v with snippet %q",
+				input.name, pe.Code, pe.Pos, pe.Snippet, input.wantCode, input.wantPos, input.wantSnippet)
+		}
+	}
+}
@@ -25,6 +25,22 @@ type parser struct {
 	bracketSameLine map[int]bool
 	config          config.Config
 	line, column    int // current position, 1-based.
+	// Whether to recover from syntax errors, see ParseWithRecovery.
+	recovering bool
+	// Syntax errors recovered from.
+	errs []*ParseError
+	// Number of enclosing messages and lists.
+	depth int
+	// Whether the last call to parse ended at a closing bracket, rather than at the end of input.
+	closed bool
+	// Position after the closing bracket of the last call to parse, if closed.
+	closedPos ast.Position
+	// Separator after the closing bracket of the last call to parse, if closed.
+	closedSeparator string
+	// Position after the last comment or template read.
+	commentsEnd ast.Position
+	// Positions of the comments and templates read, in input order.
+	commentStarts []ast.Position
 }
 
 var defConfig = config.Config{}
@@ -75,9 +91,15 @@ func (s *bracketState) processChar(c byte, i int, in []byte, allowTripleQuotedSt
 }
 
 // Return the byte-positions of each bracket which has the corresponding close on the
-// same line as a set.
-func sameLineBrackets(in []byte, allowTripleQuotedStrings bool) (map[int]bool, error) {
+// same line as a set. If lenient is true, unbalanced brackets and unterminated strings
+// are ignored rather than reported.
+func sameLineBrackets(in []byte, allowTripleQuotedStrings, lenient bool) (map[int]bool, error) {
 	line := 1
+	lineStart := 0 // Index of the first character of the current line.
+	positionOf := func(i int) ast.Position {
+		return ast.Position{Byte: uint32(i), Line: int32(line), Column: int32(i - lineStart + 1)}
+	}
+	var stringStart ast.Position
 	type bracket struct {
 		index int
 		line  int
@@ -86,11 +108,21 @@ func sameLineBrackets(in []byte, allowTripleQuotedStrings bool) (map[int]bool, e
 	res := map[int]bool{}
 	state := bracketState{}
 	for i, c := range in {
+		wasInsideString := state.insideString
 		state.processChar(c, i, in, allowTripleQuotedStrings)
+		if state.insideString && !wasInsideString {
+			stringStart = positionOf(i)
+		}
 		switch c {
 		case '\n':
 			line++
+			lineStart = i + 1
 			state.insideComment = false
+			if lenient && !state.insideTripleQuotedString {
+				// Only triple-quoted strings may span lines.
+				state.insideString = false
+				state.isEscapedChar = false
+			}
 		case '{', '<':
 			if state.insideComment || state.insideString || state.insideTemplate {
 				continue
@@ -100,8 +132,16 @@ func sameLineBrackets(in []byte, allowTripleQuotedStrings bool) (map[int]bool, e
 			if state.insideComment || state.insideString || state.insideTemplate {
 				continue
 			}
+			if len(open) == 0 && lenient {
+				continue
+			}
 			if len(open) == 0 {
-				return nil, fmt.Errorf("too many '}' or '>' at line %d, index %d", line, i)
+				return nil, &ParseError{
+					Pos:     positionOf(i),
+					Code:    UnbalancedBracket,
+					Msg:     fmt.Sprintf("too many '}' or '>' at line %d, index %d", line, i),
+					Snippet: lineAt(in, i),
+				}
 			}
 			last := len(open) - 1
 			br := open[last]
@@ -117,8 +157,13 @@ func sameLineBrackets(in []byte, allowTripleQuotedStrings bool) (map[int]bool, e
 		}
 
 	}
-	if state.insideString {
-		return nil, fmt.Errorf("unterminated string literal")
+	if state.insideString && !lenient {
+		return nil, &ParseError{
+			Pos:     stringStart,
+			Code:    UnterminatedString,
+			Msg:     "unterminated string literal",
+			Snippet: lineAt(in, int(stringStart.Byte)),
+		}
 	}
 	return res, nil
 }
@@ -144,7 +189,20 @@ func ParseWithConfig(in []byte, c config.Config) ([]*ast.Node, error) {
 
 // ParseWithMetaCommentConfig parses in textproto with MetaComments already added to configuration.
 func ParseWithMetaCommentConfig(in []byte, c config.Config) ([]*ast.Node, error) {
-	p, err := newParser(in, c)
+	nodes, err := ParseUnsorted(in, c)
+	if err != nil {
+		return nil, err
+	}
+	if err := sort.Process( /*parent=*/ nil, nodes, c); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// ParseUnsorted functions similar to ParseWithMetaCommentConfig, but doesn't sort or filter the
+// nodes, so that they stay in input order. Use sort.Process to sort them later.
+func ParseUnsorted(in []byte, c config.Config) ([]*ast.Node, error) {
+	p, err := newParser(in, c, false /* recovering */)
 	if err != nil {
 		return nil, err
 	}
@@ -159,48 +217,111 @@ func ParseWithMetaCommentConfig(in []byte, c config.Config) ([]*ast.Node, error)
 		return nil, err
 	}
 	if p.index < p.length {
-		return nil, fmt.Errorf("parser didn't consume all input. Stopped at %s", p.errorContext())
+		return nil, p.errorf(UnexpectedInput, "parser didn't consume all input")
 	}
+	p.setCommentStarts(nodes)
 	if err := wrap.Strings(nodes, 0, c); err != nil {
 		return nil, err
 	}
-	if err := sort.Process( /*parent=*/ nil, nodes, c); err != nil {
+	return nodes, nil
+}
+
+// ParseWithRecovery functions similar to ParseWithConfig, but doesn't stop at the first syntax
+// error. It skips the input up to the end of the line containing the error, or further until the
+// brackets opened in the skipped input are closed, and continues parsing from there. The skipped
+// input is kept in nodes with SyntaxError set, so that printing the nodes reproduces it.
+//
+// If there were syntax errors, the partial tree is returned along with a ParseErrors listing all
+// of them. Sorting and string wrapping are not applied to the tree.
+func ParseWithRecovery(in []byte, c config.Config) ([]*ast.Node, error) {
+	if err := AddMetaCommentsToConfig(in, &c); err != nil {
+		return nil, err
+	}
+	p, err := newParser(in, c, true /* recovering */)
+	if err != nil {
 		return nil, err
 	}
+	nodes, _, err := p.parse( /*isRoot=*/ true)
+	if err != nil {
+		return nil, err
+	}
+	p.setCommentStarts(nodes)
+	if len(p.errs) > 0 {
+		return nodes, ParseErrors(p.errs)
+	}
 	return nodes, nil
 }
 
 // There are two types of MetaComment, one in the format of <key>=<val> and the other one doesn't
-// have the equal sign. Currently there are only two MetaComments that are in the former format:
+// have the equal sign. Boolean MetaComments enable the option when given without a value, and also
+// accept an explicit <key>=true or <key>=false. Currently there are only two other MetaComments
+// that are in the former format:
 //
+//	"field_order": The <val> is "<node name>:<field>,<field>,...", see config.AddFieldSortOrder.
+//	Use config.RootName as the node name for top-level fields. If this appears multiple times for
+//	the same node name, only the last one is saved. The fields are separated by commas without
+//	spaces, as a comma followed by a space starts the next MetaComment.
 //	"sort_repeated_fields_by_subfield": If this appears multiple times, then they will all be added
 //	to the config and the order is perserved.
-//	"wrap_strings_at_column": The <val> is expected to be an integer. If it is not, then it will be
-//	ignored. If this appears multiple times, only the last one saved.
+//	"separators": The <val> is one of "remove", "preserve", "comma" or "semicolon", see
+//	config.SeparatorStyle.
+//	"canonical": The <val> is "cpp" or "go", see config.CanonicalStyle.
+//	"wrap_strings_at_column", "indent_width", "max_line_width": The <val> is expected to be an integer. If it is not,
+//	then it will be ignored. If this appears multiple times, only the last one saved.
 func addToConfig(metaComment string, c *config.Config) error {
 	// Test if a MetaComment is in the format of <key>=<val>.
 	key, val, hasEqualSign := strings.Cut(metaComment, "=")
 	switch key {
 	case "allow_triple_quoted_strings":
-		c.AllowTripleQuotedStrings = true
+		return setBool(&c.AllowTripleQuotedStrings, key, val, hasEqualSign)
 	case "allow_unnamed_nodes_everywhere":
-		c.AllowUnnamedNodesEverywhere = true
+		return setBool(&c.AllowUnnamedNodesEverywhere, key, val, hasEqualSign)
 	case "disable":
-		c.Disable = true
+		return setBool(&c.Disable, key, val, hasEqualSign)
 	case "expand_all_children":
-		c.ExpandAllChildren = true
+		return setBool(&c.ExpandAllChildren, key, val, hasEqualSign)
 	case "preserve_angle_brackets":
-		c.PreserveAngleBrackets = true
+		return setBool(&c.PreserveAngleBrackets, key, val, hasEqualSign)
+	case "field_order":
+		if !hasEqualSign {
+			return fmt.Errorf("format should be %s=<node name>:<field>,<field>,..., got: %s", key, metaComment)
+		}
+		nodeName, fieldOrder, err := config.ParseFieldSortOrder(val)
+		if err != nil {
+			return err
+		}
+		// The map may be shared with the caller's copy of the config, so don't modify it in place.
+		order := make(map[string][]string, len(c.FieldSortOrder)+1)
+		for k, v := range c.FieldSortOrder {
+			order[k] = v
+		}
+		c.FieldSortOrder = order
+		c.AddFieldSortOrder(nodeName, fieldOrder...)
+	case "require_field_sort_order_to_match_all_fields_in_node":
+		return setBool(&c.RequireFieldSortOrderToMatchAllFieldsInNode, key, val, hasEqualSign)
 	case "remove_duplicate_values_for_repeated_fields":
-		c.RemoveDuplicateValuesForRepeatedFields = true
+		return setBool(&c.RemoveDuplicateValuesForRepeatedFields, key, val, hasEqualSign)
 	case "skip_all_colons":
-		c.SkipAllColons = true
+		return setBool(&c.SkipAllColons, key, val, hasEqualSign)
+	case "colons_before_messages":
+		return setBool(&c.ColonsBeforeMessages, key, val, hasEqualSign)
+	case "colons_before_scalars":
+		return setBool(&c.ColonsBeforeScalars, key, val, hasEqualSign)
+	case "separators":
+		if !hasEqualSign {
+			return fmt.Errorf("format should be %s=<style>, got: %s", key, metaComment)
+		}
+		s, err := config.ParseSeparatorStyle(val)
+		if err != nil {
+			return err
+		}
+		c.Separators = s
 	case "smartquotes":
-		c.SmartQuotes = true
+		return setBool(&c.SmartQuotes, key, val, hasEqualSign)
 	case "sort_fields_by_field_name":
-		c.SortFieldsByFieldName = true
+		return setBool(&c.SortFieldsByFieldName, key, val, hasEqualSign)
 	case "sort_repeated_fields_by_content":
-		c.SortRepeatedFieldsByContent = true
+		return setBool(&c.SortRepeatedFieldsByContent, key, val, hasEqualSign)
 	case "sort_repeated_fields_by_subfield":
 		// Take all the subfields and the subfields in order as tie breakers.
 		if !hasEqualSign {
@@ -208,23 +329,37 @@ func addToConfig(metaComment string, c *config.Config) error {
 		}
 		c.SortRepeatedFieldsBySubfield = append(c.SortRepeatedFieldsBySubfield, val)
 	case "reverse_sort":
-		c.ReverseSort = true
+		return setBool(&c.ReverseSort, key, val, hasEqualSign)
 	case "wrap_strings_at_column":
 		// If multiple of this MetaComment exists in the file, take the last one.
+		return setInt(&c.WrapStringsAtColumn, metaComment, key, val, hasEqualSign)
+	case "indent_width":
+		return setInt(&c.IndentWidth, metaComment, key, val, hasEqualSign)
+	case "use_tabs":
+		return setBool(&c.UseTabs, key, val, hasEqualSign)
+	case "max_line_width":
+		return setInt(&c.MaxLineWidth, metaComment, key, val, hasEqualSign)
+	case "canonical":
 		if !hasEqualSign {
-			return fmt.Errorf("format should be %s=<int>, got: %s", key, metaComment)
+			return fmt.Errorf("format should be %s=<style>, got: %s", key, metaComment)
 		}
-		i, err := strconv.Atoi(strings.TrimSpace(val))
+		s, err := config.ParseCanonicalStyle(val)
 		if err != nil {
-			return fmt.Errorf("error parsing %s value %q (skipping): %v", key, val, err)
+			return err
 		}
-		c.WrapStringsAtColumn = i
+		c.Canonical = s
+	case "remove_comments":
+		return setBool(&c.RemoveComments, key, val, hasEqualSign)
+	case "align_values":
+		return setBool(&c.AlignValues, key, val, hasEqualSign)
+	case "align_comments":
+		return setBool(&c.AlignComments, key, val, hasEqualSign)
 	case "wrap_html_strings":
-		c.WrapHTMLStrings = true
+		return setBool(&c.WrapHTMLStrings, key, val, hasEqualSign)
 	case "wrap_strings_after_newlines":
-		c.WrapStringsAfterNewlines = true
+		return setBool(&c.WrapStringsAfterNewlines, key, val, hasEqualSign)
 	case "wrap_strings_without_wordwrap":
-		c.WrapStringsWithoutWordwrap = true
+		return setBool(&c.WrapStringsWithoutWordwrap, key, val, hasEqualSign)
 	case "on": // This doesn't change the overall config.
 	case "off": // This doesn't change the overall config.
 	default:
@@ -233,6 +368,33 @@ func addToConfig(metaComment string, c *config.Config) error {
 	return nil
 }
 
+// setBool sets *b from a MetaComment that is either just the key, meaning true, or <key>=<bool>.
+func setBool(b *bool, key, val string, hasEqualSign bool) error {
+	if !hasEqualSign {
+		*b = true
+		return nil
+	}
+	v, err := strconv.ParseBool(strings.TrimSpace(val))
+	if err != nil {
+		return fmt.Errorf("error parsing %s value %q: %v", key, val, err)
+	}
+	*b = v
+	return nil
+}
+
+// setInt sets *i from a MetaComment of the form <key>=<int>.
+func setInt(i *int, metaComment, key, val string, hasEqualSign bool) error {
+	if !hasEqualSign {
+		return fmt.Errorf("format should be %s=<int>, got: %s", key, metaComment)
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(val))
+	if err != nil {
+		return fmt.Errorf("error parsing %s value %q (skipping): %v", key, val, err)
+	}
+	*i = v
+	return nil
+}
+
 // AddMetaCommentsToConfig parses MetaComments and adds them to the configuration.
 func AddMetaCommentsToConfig(in []byte, c *config.Config) error {
 	scanner := bufio.NewScanner(bytes.NewReader(in))
@@ -250,9 +412,18 @@ func AddMetaCommentsToConfig(in []byte, c *config.Config) error {
 		// # txtpbfmt: <MetaComment 1>[, <MetaComment 2> ...]
 		key, value, hasColon := strings.Cut(line[1:], ":") // Ignore the first '#'.
 		if hasColon && strings.TrimSpace(key) == "txtpbfmt" {
-			for _, s := range strings.Split(strings.TrimSpace(value), ",") {
-				metaComment := strings.TrimSpace(s)
-				if err := addToConfig(metaComment, c); err != nil {
+			metaComments := strings.Split(strings.TrimSpace(value), ",")
+			for i := 0; i < len(metaComments); i++ {
+				metaComment := strings.TrimSpace(metaComments[i])
+				if strings.HasPrefix(metaComment, "field_order=") {
+					// The field list is comma-separated as well, and ends at the first comma followed by
+					// a space.
+					for i+1 < len(metaComments) && strings.TrimLeft(metaComments[i+1], " \t") == metaComments[i+1] {
+						i++
+						metaComment += "," + metaComments[i]
+					}
+				}
+				if err := addToConfig(strings.TrimSpace(metaComment), c); err != nil {
 					return err
 				}
 			}
@@ -261,13 +432,13 @@ func AddMetaCommentsToConfig(in []byte, c *config.Config) error {
 	return nil
 }
 
-func newParser(in []byte, c config.Config) (*parser, error) {
+func newParser(in []byte, c config.Config, recovering bool) (*parser, error) {
 	var bracketSameLine map[int]bool
 	if c.ExpandAllChildren {
 		bracketSameLine = map[int]bool{}
 	} else {
 		var err error
-		if bracketSameLine, err = sameLineBrackets(in, c.AllowTripleQuotedStrings); err != nil {
+		if bracketSameLine, err = sameLineBrackets(in, c.AllowTripleQuotedStrings, recovering); err != nil {
 			return nil, err
 		}
 	}
@@ -282,6 +453,7 @@ func newParser(in []byte, c config.Config) (*parser, error) {
 		config:          c,
 		line:            1,
 		column:          1,
+		recovering:      recovering,
 	}
 	return parser, nil
 }
@@ -334,7 +506,7 @@ func (l *loopDetector) iter() error {
 		if l.count < 2 {
 			return nil
 		}
-		return fmt.Errorf("parser failed to make progress at %s", l.parser.errorContext())
+		return l.parser.errorf(LoopDetected, "parser failed to make progress")
 	}
 	l.lastIndex = l.parser.index
 	l.count = 0
@@ -376,18 +548,20 @@ func (p *parser) rollbackPosition(pos ast.Position) {
 	p.column = int(pos.Column)
 }
 
-func (p *parser) consumeOptionalSeparator() error {
+// consumeOptionalSeparator consumes the ';' or ',' after a field, if any, and returns it.
+func (p *parser) consumeOptionalSeparator() (string, error) {
 	if p.index > 0 && !p.isBlankSep(p.index-1) {
 		// If an unnamed field immediately follows non-whitespace, we require a separator character first (key_one:,:value_two instead of key_one::value_two)
 		if p.consume(':') {
-			return fmt.Errorf("parser encountered unexpected character ':' (should be whitespace, ',', or ';')")
+			return "", p.errorf(UnexpectedInput, "parser encountered unexpected character ':' (should be whitespace, ',', or ';')")
 		}
 	}
 
-	_ = p.consume(';') // Ignore optional ';'.
-	_ = p.consume(',') // Ignore optional ','.
+	start := p.index
+	_ = p.consume(';') // Optional ';'.
+	_ = p.consume(',') // Optional ','.
 
-	return nil
+	return string(p.in[start:p.index]), nil
 }
 
 // parse parses a text proto.
@@ -399,9 +573,14 @@ func (p *parser) consumeOptionalSeparator() error {
 func (p *parser) parse(isRoot bool) (result []*ast.Node, endPos ast.Position, err error) {
 	var res []*ast.Node
 	res = []*ast.Node{} // empty children is different from nil children
+	p.closed = false
 	for ld := p.getLoopDetector(); p.index < p.length; {
 		if err := ld.iter(); err != nil {
-			return nil, ast.Position{}, err
+			if !p.recoverFrom(err) {
+				return nil, ast.Position{}, err
+			}
+			res = append(res, p.invalidNode(p.position(), err))
+			continue
 		}
 
 		// p.parse is often invoked with the index pointing at the newline character
@@ -413,12 +592,18 @@ func (p *parser) parse(isRoot bool) (result []*ast.Node, endPos ast.Position, er
 
 		fmtDisabled, err := p.readFormatterDisabledBlock()
 		if err != nil {
-			return nil, startPos, err
+			if !p.recoverFrom(err) {
+				return nil, startPos, err
+			}
+			res = append(res, p.invalidNode(p.position(), err))
+			continue
 		}
 		if len(fmtDisabled) > 0 {
 			res = append(res, &ast.Node{
-				Start: startPos,
-				Raw:   fmtDisabled,
+				Start:      startPos,
+				FieldStart: startPos,
+				FieldEnd:   p.position(),
+				Raw:        fmtDisabled,
 			})
 			continue
 		}
@@ -436,18 +621,37 @@ func (p *parser) parse(isRoot bool) (result []*ast.Node, endPos ast.Position, er
 		}
 
 		for p.nextInputIs('%') {
+			p.addCommentStart(p.position())
 			comments = append(comments, p.readTemplate())
+			p.commentsEnd = p.position()
 			c, _ := p.skipWhiteSpaceAndReadComments(false)
 			comments = append(comments, c...)
 		}
 
-		if endPos := p.position(); p.consume('}') || p.consume('>') || p.consume(']') {
+		// Comment-only nodes end after their last comment.
+		commentsEnd := p.position()
+		if len(comments) > 0 && comments[len(comments)-1] != "" {
+			commentsEnd = p.commentsEnd
+		}
+
+		if endPos := p.position(); p.nextInputIs('}') || p.nextInputIs('>') || p.nextInputIs(']') {
 			// Handle comments after last child.
 
 			if len(comments) > 0 {
-				res = append(res, &ast.Node{Start: startPos, PreComments: comments})
+				res = append(res, &ast.Node{Start: startPos, PreComments: comments, FieldStart: commentsEnd, FieldEnd: commentsEnd})
 			}
 
+			if p.recovering && p.depth == 0 {
+				// There is no enclosing message or list to close.
+				err := p.errorf(UnbalancedBracket, "unexpected %q without matching opening bracket", p.in[p.index])
+				p.recoverFrom(err)
+				res = append(res, p.invalidNode(endPos, err))
+				continue
+			}
+			p.index++
+			p.column++
+			p.closedPos = p.position()
+
 			// endPos points at the closing brace, but we should rather return the position
 			// of the first character after the previous item. Therefore let's rewind a bit:
 			for endPos.Byte > 0 && p.in[endPos.Byte-1] == ' ' {
@@ -455,11 +659,12 @@ func (p *parser) parse(isRoot bool) (result []*ast.Node, endPos ast.Position, er
 				endPos.Column--
 			}
 
-			if err = p.consumeOptionalSeparator(); err != nil {
+			if p.closedSeparator, err = p.consumeOptionalSeparator(); err != nil && !p.recoverFrom(err) {
 				return nil, ast.Position{}, err
 			}
 
 			// Done parsing children.
+			p.closed = true
 			return res, endPos, nil
 		}
 
@@ -474,6 +679,8 @@ func (p *parser) parse(isRoot bool) (result []*ast.Node, endPos ast.Position, er
 		// Skip white-space other than '\n', which is handled below.
 		for p.consume(' ') || p.consume('\t') {
 		}
+		nd.FieldStart = p.position()
+		nd.FieldEnd = nd.FieldStart
 
 		// Handle multiple comment blocks.
 		// <example>
@@ -486,6 +693,7 @@ func (p *parser) parse(isRoot bool) (result []*ast.Node, endPos ast.Position, er
 		// Each block that ends on an empty line (instead of a field) gets its own
 		// 'empty' node.
 		if p.nextInputIs('\n') {
+			nd.FieldStart, nd.FieldEnd = commentsEnd, commentsEnd
 			res = append(res, nd)
 			continue
 		}
@@ -493,55 +701,70 @@ func (p *parser) parse(isRoot bool) (result []*ast.Node, endPos ast.Position, er
 		// Handle end of file.
 		if p.index >= p.length {
 			nd.End = p.position()
+			nd.FieldStart, nd.FieldEnd = commentsEnd, commentsEnd
 			if len(nd.PreComments) > 0 {
 				res = append(res, nd)
 			}
 			break
 		}
 
-		if err := p.parseFieldName(nd, isRoot); err != nil {
-			return nil, ast.Position{}, err
-		}
-
-		// Skip separator.
-		preCommentsBeforeColon, _ := p.skipWhiteSpaceAndReadComments(true /* multiLine */)
-		nd.SkipColon = !p.consume(':')
-		previousPos := p.position()
-		preCommentsAfterColon, _ := p.skipWhiteSpaceAndReadComments(true /* multiLine */)
-
-		if p.consume('{') || p.consume('<') {
-			if err := p.parseMessage(nd); err != nil {
-				return nil, ast.Position{}, err
-			}
-		} else if p.consume('[') {
-			if err := p.parseList(nd, preCommentsBeforeColon, preCommentsAfterColon); err != nil {
-				return nil, ast.Position{}, err
-			}
-			if nd.ValuesAsList {
-				res = append(res, nd)
-				continue
-			}
-		} else {
-			// Rewind comments.
-			p.rollbackPosition(previousPos)
-			// Handle Values.
-			var err error
-			nd.Values, err = p.readValues()
-			if err != nil {
+		fieldPos := p.position()
+		if err := p.parseField(nd, isRoot); err != nil {
+			if !p.recoverFrom(err) {
 				return nil, ast.Position{}, err
 			}
-			if err := p.consumeOptionalSeparator(); err != nil {
-				return nil, ast.Position{}, err
+			// Keep the comments, which can't be attached to the skipped input.
+			if len(nd.PreComments) > 0 {
+				res = append(res, &ast.Node{Start: startPos, PreComments: nd.PreComments, FieldStart: commentsEnd, FieldEnd: commentsEnd})
 			}
+			res = append(res, p.invalidNode(p.lineStart(fieldPos), err))
+			continue
 		}
 		if p.config.InfoLevel() && p.index < p.length {
 			p.config.Infof("p.in[p.index]: %q", string(p.in[p.index]))
 		}
 		res = append(res, nd)
 	}
+	p.closed = false
 	return res, p.position(), nil
 }
 
+// parseField parses the name and value(s) or children of a field into nd.
+func (p *parser) parseField(nd *ast.Node, isRoot bool) error {
+	if err := p.parseFieldName(nd, isRoot); err != nil {
+		return err
+	}
+
+	// Skip separator.
+	preCommentsBeforeColon, _ := p.skipWhiteSpaceAndReadComments(true /* multiLine */)
+	nd.SkipColon = !p.consume(':')
+	previousPos := p.position()
+	preCommentsAfterColon, _ := p.skipWhiteSpaceAndReadComments(true /* multiLine */)
+
+	if p.consume('{') || p.consume('<') {
+		return p.parseMessage(nd)
+	}
+	if p.consume('[') {
+		return p.parseList(nd, preCommentsBeforeColon, preCommentsAfterColon)
+	}
+	// Rewind comments.
+	p.rollbackPosition(previousPos)
+	// Handle Values.
+	var err error
+	nd.Values, err = p.readValues()
+	if err != nil {
+		return err
+	}
+	if len(nd.Values) > 0 {
+		nd.FieldEnd = nd.Values[len(nd.Values)-1].End
+	}
+	if p.config.ColonsBeforeScalars {
+		nd.SkipColon = false
+	}
+	nd.Separator, err = p.consumeOptionalSeparator()
+	return err
+}
+
 func (p *parser) parseFieldName(nd *ast.Node, isRoot bool) error {
 	if p.consume('[') {
 		// Read Name (of proto extension).
@@ -551,7 +774,7 @@ func (p *parser) parseFieldName(nd *ast.Node, isRoot bool) error {
 		// Read Name.
 		nd.Name = p.readFieldName()
 		if nd.Name == "" && !isRoot && !p.config.AllowUnnamedNodesEverywhere {
-			return fmt.Errorf("Failed to find a FieldName at %s", p.errorContext())
+			return p.errorf(MissingFieldName, "Failed to find a FieldName")
 		}
 	}
 	if p.config.InfoLevel() {
@@ -563,16 +786,35 @@ func (p *parser) parseFieldName(nd *ast.Node, isRoot bool) error {
 func (p *parser) parseMessage(nd *ast.Node) error {
 	if p.config.SkipAllColons {
 		nd.SkipColon = true
+	} else if p.config.ColonsBeforeMessages {
+		nd.SkipColon = false
 	}
 	nd.ChildrenSameLine = p.bracketSameLine[p.index-1]
 	nd.IsAngleBracket = p.config.PreserveAngleBrackets && p.in[p.index-1] == '<'
+	openPos := p.position()
 	// Recursive call to parse child nodes.
+	p.depth++
 	nodes, lastPos, err := p.parse( /*isRoot=*/ false)
+	p.depth--
 	if err != nil {
 		return err
 	}
+	if p.recovering && !p.closed {
+		openPos.Byte--
+		openPos.Column--
+		p.errs = append(p.errs, &ParseError{
+			Pos:     openPos,
+			Code:    UnbalancedBracket,
+			Msg:     fmt.Sprintf("missing closing bracket for %q", nd.Name),
+			Snippet: lineAt(p.in, int(openPos.Byte)),
+		})
+	}
 	nd.Children = nodes
 	nd.End = lastPos
+	nd.FieldEnd = p.endOfChildren()
+	if p.closed {
+		nd.Separator = p.closedSeparator
+	}
 
 	nd.ClosingBraceComment = p.readInlineComment()
 	return nil
@@ -593,18 +835,30 @@ func (p *parser) parseList(nd *ast.Node, preCommentsBeforeColon, preCommentsAfte
 		// Handle list of nodes.
 		nd.ChildrenAsList = true
 
+		p.depth++
 		nodes, lastPos, err := p.parse( /*isRoot=*/ true)
+		p.depth--
 		if err != nil {
 			return err
 		}
 		if len(nodes) > 0 {
 			nodes[0].PreComments = preComments
 		}
+		for _, item := range nodes {
+			item.Separator = "" // The commas between list items aren't separators of fields.
+		}
 
 		nd.Children = nodes
 		nd.End = lastPos
+		nd.FieldEnd = p.endOfChildren()
+		if p.closed {
+			nd.Separator = p.closedSeparator
+		}
 		nd.ClosingBraceComment = p.readInlineComment()
 		nd.ChildrenSameLine = openBracketLine == p.line
+		if p.config.ColonsBeforeMessages {
+			nd.SkipColon = false
+		}
 	} else {
 		// Handle list of values.
 		nd.ValuesAsList = true // We found values in list - keep it as list.
@@ -620,7 +874,7 @@ func (p *parser) parseList(nd *ast.Node, preCommentsBeforeColon, preCommentsAfte
 				return err
 			}
 			if len(vals) != 1 {
-				return fmt.Errorf("multiple-string value not supported (%v). Please add comma explicitly, see http://b/162070952", vals)
+				return p.errorf(MultipleStringValues, "multiple-string value not supported (%v). Please add comma explicitly, see http://b/162070952", vals)
 			}
 			if len(preComments) > 0 {
 				// If we read preComments before readValues(), they should go first,
@@ -638,19 +892,33 @@ func (p *parser) parseList(nd *ast.Node, preCommentsBeforeColon, preCommentsAfte
 
 			preComments, _ = p.skipWhiteSpaceAndReadComments(true /* multiLine */)
 		}
+		nd.FieldEnd = p.position()
 		nd.ChildrenSameLine = openBracketLine == p.line
 
 		// Handle comments after last line (or for empty list)
 		nd.PostValuesComments = preComments
 		nd.ClosingBraceComment = p.readInlineComment()
+		if p.config.ColonsBeforeScalars {
+			nd.SkipColon = false
+		}
 
-		if err := p.consumeOptionalSeparator(); err != nil {
+		var err error
+		if nd.Separator, err = p.consumeOptionalSeparator(); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// endOfChildren returns the position after the closing bracket of the children just parsed, or
+// the current position if they were not closed.
+func (p *parser) endOfChildren() ast.Position {
+	if p.closed {
+		return p.closedPos
+	}
+	return p.position()
+}
+
 func (p *parser) readFieldName() string {
 	i := p.index
 	for ; i < p.length && !p.isValueSep(i); i++ {
@@ -698,7 +966,7 @@ func (p *parser) consumeWhitespace() (int, error) {
 		} else if p.consume(' ') || p.consume('\t') {
 			// Do nothing. Side-effect is to advance p.index.
 		} else {
-			return 0, fmt.Errorf("unhandled isBlankSep at %s", p.errorContext())
+			return 0, p.errorf(UnexpectedInput, "unhandled isBlankSep")
 		}
 	}
 	return start, nil
@@ -723,12 +991,12 @@ func (p *parser) readFormatterDisabledBlock() (string, error) {
 		return "", nil
 	}
 	if !p.consume('\n') {
-		return "", fmt.Errorf("txtpbfmt off should be followed by newline at %s", p.errorContext())
+		return "", p.errorf(InvalidFormatterDirective, "txtpbfmt off should be followed by newline")
 	}
 	for ; p.index < p.length; p.index++ {
 		if p.consumeString("# txtpbfmt: on") {
 			if !p.consume('\n') {
-				return "", fmt.Errorf("txtpbfmt on should be followed by newline at %s", p.errorContext())
+				return "", p.errorf(InvalidFormatterDirective, "txtpbfmt on should be followed by newline")
 			}
 			// Retain up to one blank line.
 			p.consume('\n')
@@ -737,7 +1005,7 @@ func (p *parser) readFormatterDisabledBlock() (string, error) {
 	}
 	// We reached the end of the file without finding the 'on' directive.
 	p.rollbackPosition(previousPos)
-	return "", fmt.Errorf("unterminated txtpbfmt off at %s", p.errorContext())
+	return "", p.errorf(UnterminatedFormatterOff, "unterminated txtpbfmt off")
 }
 
 // skipWhiteSpaceAndReadComments has multiple cases:
@@ -766,6 +1034,8 @@ func (p *parser) skipWhiteSpaceAndReadComments(multiLine bool) ([]string, int) {
 		} else if p.in[i] == '\n' {
 			if insideComment {
 				comments = append(comments, string(p.in[commentBegin:i])) // Exclude the '\n'.
+				p.addCommentStart(p.positionAt(commentBegin))
+				p.commentsEnd = p.positionAt(i)
 				insideComment = false
 			} else if foundComment {
 				i-- // Put back the last '\n' so the caller can detect that we're on case (1).
@@ -791,6 +1061,66 @@ func (p *parser) skipWhiteSpaceAndReadComments(multiLine bool) ([]string, int) {
 	return comments, blankLines
 }
 
+// addCommentStart records the position of a comment read. Comments read again after rolling back
+// are only recorded once.
+func (p *parser) addCommentStart(pos ast.Position) {
+	if n := len(p.commentStarts); n == 0 || p.commentStarts[n-1].Byte < pos.Byte {
+		p.commentStarts = append(p.commentStarts, pos)
+	}
+}
+
+// setCommentStarts sets the CommentStarts of nodes and their values to the positions of their
+// comments, which are looked up in input order among the comments read.
+func (p *parser) setCommentStarts(nodes []*ast.Node) {
+	for _, nd := range nodes {
+		nd.CommentStarts = p.nextCommentStarts(nd.PreComments)
+		for _, v := range nd.Values {
+			v.CommentStarts = append(p.nextCommentStarts(v.PreComments), p.nextCommentStarts([]string{v.InlineComment})...)
+		}
+		p.setCommentStarts(nd.Children)
+		nd.CommentStarts = append(nd.CommentStarts, p.nextCommentStarts(nd.PostValuesComments)...)
+		nd.CommentStarts = append(nd.CommentStarts, p.nextCommentStarts([]string{nd.ClosingBraceComment})...)
+	}
+}
+
+// nextCommentStarts returns the positions of the non-empty lines of comments, looking each one up
+// after the previous one among the comments read. Comments that weren't kept in the tree are
+// skipped. If a line isn't found, nothing is consumed and nil is returned.
+func (p *parser) nextCommentStarts(comments []string) []ast.Position {
+	var res []ast.Position
+	rest := p.commentStarts
+	for _, c := range comments {
+		if c == "" {
+			continue
+		}
+		for len(rest) > 0 && !bytes.HasPrefix(p.in[rest[0].Byte:], []byte(c)) {
+			rest = rest[1:]
+		}
+		if len(rest) == 0 {
+			return nil
+		}
+		res = append(res, rest[0])
+		rest = rest[1:]
+	}
+	p.commentStarts = rest
+	return res
+}
+
+// positionAt returns the position of the input at index i, which must not precede the current
+// index.
+func (p *parser) positionAt(i int) ast.Position {
+	pos := p.position()
+	for j := p.index; j < i; j++ {
+		pos.Byte++
+		pos.Column++
+		if p.in[j] == '\n' {
+			pos.Line++
+			pos.Column = 1
+		}
+	}
+	return pos
+}
+
 func (p *parser) isBlankSep(i int) bool {
 	return bytes.Contains(spaceSeparators, p.in[i:i+1])
 }
@@ -821,7 +1151,8 @@ func (p *parser) readValues() ([]*ast.Value, error) {
 	var previousPos ast.Position
 	preComments, _ := p.skipWhiteSpaceAndReadComments(true /* multiLine */)
 	if p.nextInputIs('%') {
-		values = append(values, p.populateValue(p.readTemplate(), nil))
+		start := p.position()
+		values = append(values, p.populateValue(p.readTemplate(), start, nil))
 		previousPos = p.position()
 	}
 	if v, err := p.readTripleQuotedStringValue(); err != nil {
@@ -865,6 +1196,9 @@ func (p *parser) readTripleQuotedStringValue() (*ast.Value, error) {
 
 func (p *parser) readSingleQuotedStringValue(preComments []string) (*ast.Value, error) {
 	stringBegin := p.index - 1 // Index of the quote.
+	start := p.position()
+	start.Byte--
+	start.Column--
 	i := p.index
 	for ; i < p.length; i++ {
 		if p.in[i] == '\\' {
@@ -872,8 +1206,8 @@ func (p *parser) readSingleQuotedStringValue(preComments []string) (*ast.Value,
 			continue
 		}
 		if p.in[i] == '\n' {
-			p.index = i
-			return nil, fmt.Errorf("found literal (unescaped) new line in string at %s", p.errorContext())
+			p.advance(i)
+			return nil, p.errorf(NewlineInString, "found literal (unescaped) new line in string")
 		}
 		if p.in[i] == p.in[stringBegin] {
 			var vl string
@@ -883,28 +1217,29 @@ func (p *parser) readSingleQuotedStringValue(preComments []string) (*ast.Value,
 				vl = quote.Fix(p.advance(i))
 			}
 			_ = p.advance(i + 1) // Skip the quote.
-			return p.populateValue(vl, preComments), nil
+			return p.populateValue(vl, start, preComments), nil
 		}
 	}
 	if i == p.length {
-		p.index = i
-		return nil, fmt.Errorf("unfinished string at %s", p.errorContext())
+		p.advance(i)
+		return nil, p.errorf(UnterminatedString, "unfinished string")
 	}
 	return nil, nil
 }
 
 func (p *parser) readOtherValue(i int, preComments []string) *ast.Value {
+	start := p.position()
 	for ; i < p.length; i++ {
 		if p.isValueSep(i) {
 			break
 		}
 	}
 	vl := p.advance(i)
-	return p.populateValue(vl, preComments)
+	return p.populateValue(vl, start, preComments)
 }
 
 func (p *parser) readTripleQuotedString() (*ast.Value, error) {
-	start := p.index
+	start := p.position()
 	stringBegin := p.index
 	delimiter := `"""`
 	if !p.consumeString(delimiter) {
@@ -919,25 +1254,30 @@ func (p *parser) readTripleQuotedString() (*ast.Value, error) {
 			break
 		}
 		if p.index == p.length {
-			p.index = start
-			return nil, fmt.Errorf("unfinished string at %s", p.errorContext())
+			p.rollbackPosition(start)
+			return nil, p.errorf(UnterminatedString, "unfinished string")
 		}
-		p.index++
+		p.advance(p.index + 1)
 	}
 
-	v := p.populateValue(string(p.in[stringBegin:p.index]), nil)
+	v := p.populateValue(string(p.in[stringBegin:p.index]), start, nil)
 
 	return v, nil
 }
 
-func (p *parser) populateValue(vl string, preComments []string) *ast.Value {
+// populateValue returns the value vl read from start to the current position, followed by its
+// inline comment.
+func (p *parser) populateValue(vl string, start ast.Position, preComments []string) *ast.Value {
 	if p.config.InfoLevel() {
 		p.config.Infof("value: %q", vl)
 	}
+	end := p.position()
 	return &ast.Value{
 		Value:         vl,
 		InlineComment: p.readInlineComment(),
 		PreComments:   preComments,
+		Start:         start,
+		End:           end,
 	}
 }
 
@@ -1,9 +1,11 @@
 package impl
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/kylelemons/godebug/pretty"
+	"github.com/protocolbuffers/txtpbfmt/config"
 )
 
 func TestPreprocess(t *testing.T) {
@@ -174,7 +176,7 @@ p        {}`,
 		// ensure capacity is equal to length to catch slice index out of bounds errors
 		bytes = bytes[0:len(bytes):len(bytes)]
 		if input.testType != tripleQuotedTest {
-			have, err := sameLineBrackets(bytes, false)
+			have, err := sameLineBrackets(bytes, false, false /* lenient */)
 			if (err != nil) != input.err {
 				t.Errorf("sameLineBrackets[%s] allowTripleQuotedStrings=false %v returned err %v", input.name, input.in, err)
 				continue
@@ -185,7 +187,7 @@ p        {}`,
 		}
 
 		if input.testType != nonTripleQuotedTest {
-			have, err := sameLineBrackets(bytes, true)
+			have, err := sameLineBrackets(bytes, true, false /* lenient */)
 			if (err != nil) != input.err {
 				t.Errorf("sameLineBrackets[%s] allowTripleQuotedStrings=true %v returned err %v", input.name, input.in, err)
 				continue
@@ -196,3 +198,35 @@ p        {}`,
 		}
 	}
 }
+
+func TestAddMetaCommentsToConfigFieldOrder(t *testing.T) {
+	shared := map[string][]string{"a": {"x"}}
+	c := config.Config{FieldSortOrder: shared}
+	in := `# txtpbfmt: reverse_sort, field_order=job:name,owner
+# txtpbfmt: field_order=__ROOT__:c,a, expand_all_children
+# txtpbfmt: field_order=a:y,z
+job {}
+`
+	if err := AddMetaCommentsToConfig([]byte(in), &c); err != nil {
+		t.Fatalf("AddMetaCommentsToConfig returned err %v", err)
+	}
+	want := map[string][]string{"a": {"y", "z"}, "job": {"name", "owner"}, config.RootName: {"c", "a"}}
+	if diff := pretty.Compare(want, c.FieldSortOrder); diff != "" {
+		t.Errorf("AddMetaCommentsToConfig FieldSortOrder diff (-want, +got):\n%s", diff)
+	}
+	if !c.ReverseSort {
+		t.Errorf("AddMetaCommentsToConfig didn't set ReverseSort")
+	}
+	if !c.ExpandAllChildren {
+		t.Errorf("AddMetaCommentsToConfig didn't set ExpandAllChildren after a field_order")
+	}
+	if diff := pretty.Compare(map[string][]string{"a": {"x"}}, shared); diff != "" {
+		t.Errorf("AddMetaCommentsToConfig modified the caller's FieldSortOrder (-want, +got):\n%s", diff)
+	}
+
+	// A space after a comma ends the field list.
+	in = "# txtpbfmt: field_order=job:name, owner\njob {}\n"
+	if err := AddMetaCommentsToConfig([]byte(in), &config.Config{}); err == nil || !strings.Contains(err.Error(), "unrecognized MetaComment: owner") {
+		t.Errorf("AddMetaCommentsToConfig(%q) returned err %v, want unrecognized MetaComment", in, err)
+	}
+}
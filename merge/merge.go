@@ -0,0 +1,707 @@
+// Package merge provides a three-way merge of parse trees, to combine the changes made to a text
+// proto file on two branches since their common ancestor.
+package merge
+
+import (
+	"strings"
+
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/config"
+	"github.com/protocolbuffers/txtpbfmt/printer"
+)
+
+// Conflict markers surrounding the two versions of a conflicting field.
+const (
+	oursMarker   = "<<<<<<< ours\n"
+	sepMarker    = "=======\n"
+	theirsMarker = ">>>>>>> theirs\n"
+)
+
+type options struct {
+	keys []key
+	// printConfig is used to print the versions of conflicting fields.
+	printConfig config.Config
+}
+
+type key struct {
+	// field is the name of the repeated messages, or empty for all.
+	field        string
+	subfieldPath []string
+}
+
+// An Option configures Merge.
+type Option func(*options)
+
+// KeyBySubfield makes Merge match repeated messages by the value of a subfield. The spec has the
+// format of config.Config.SortRepeatedFieldsBySubfield: "{field}.{subfield1}.{subfield2}..." for
+// the messages of the given field name, or "{subfield}" for all repeated messages.
+//
+// Messages without the subfield, or with the same value as another, are matched by position.
+func KeyBySubfield(spec string) Option {
+	parts := strings.Split(spec, ".")
+	k := key{subfieldPath: parts}
+	if len(parts) > 1 {
+		k = key{field: parts[0], subfieldPath: parts[1:]}
+	}
+	return func(o *options) {
+		o.keys = append(o.keys, k)
+	}
+}
+
+// PrintConfig makes Merge print the versions of conflicting fields with the indentation configured
+// by c, which should match how the result is printed.
+func PrintConfig(c config.Config) Option {
+	return func(o *options) {
+		o.printConfig = c
+	}
+}
+
+// Merge merges the changes from base to theirs into ours, field by field, and returns the merged
+// nodes along with the number of conflicts. The arguments aren't modified.
+//
+// Fields changed on one side only take the changed version, and messages changed on both sides are
+// merged recursively. Repeated fields are matched by the keys given with KeyBySubfield, or by
+// position. The comments of ours are kept, without the comment lines theirs removed and with those
+// it added; comments not attached to a field are merged the same way as whole blocks. New fields
+// and comments are placed after the node preceding them in theirs.
+//
+// Fields changed differently on both sides, fields removed on one side but changed on the other,
+// and comments replaced differently on both sides are conflicts. They are replaced with a node
+// whose Raw content holds both versions between conflict markers, as printed at their depth; for
+// the comments of a field, these are the versions of the whole field:
+//
+//	<<<<<<< ours
+//	  cpu: 2
+//	=======
+//	  cpu: 4
+//	>>>>>>> theirs
+func Merge(base, ours, theirs []*ast.Node, opts ...Option) ([]*ast.Node, int) {
+	m := &merger{}
+	for _, opt := range opts {
+		opt(&m.options)
+	}
+	res := m.mergeNodes(base, ours, theirs, 0)
+	for _, nd := range res {
+		nd.Fix()
+	}
+	return res, m.conflicts
+}
+
+type merger struct {
+	options
+	conflicts int
+}
+
+// Indices of the versions in a triple.
+const (
+	baseSide = iota
+	oursSide
+	theirsSide
+)
+
+// triple holds the versions of a field in base, ours and theirs; a nil node means that the field
+// is absent from that version.
+type triple [3]*ast.Node
+
+// mergeNodes merges the children of the three versions of a message at the given depth.
+func (m *merger) mergeNodes(base, ours, theirs []*ast.Node, depth int) []*ast.Node {
+	versions := [3][]*ast.Node{fields(base), fields(ours), fields(theirs)}
+	var names []string
+	seen := map[string]bool{}
+	for _, side := range []int{oursSide, theirsSide, baseSide} {
+		for _, nd := range versions[side] {
+			if !seen[nd.Name] {
+				seen[nd.Name] = true
+				names = append(names, nd.Name)
+			}
+		}
+	}
+	byBase := map[*ast.Node]*triple{}
+	byOurs := map[*ast.Node]*triple{}
+	byTheirs := map[*ast.Node]*triple{}
+	merged := map[*triple]*ast.Node{}
+	for _, name := range names {
+		for _, tr := range m.match(name, byName(versions[baseSide], name), byName(versions[oursSide], name), byName(versions[theirsSide], name)) {
+			merged[tr] = m.mergeField(tr, depth)
+			if b := tr[baseSide]; b != nil {
+				byBase[b] = tr
+			}
+			if o := tr[oursSide]; o != nil {
+				byOurs[o] = tr
+			}
+			if t := tr[theirsSide]; t != nil {
+				byTheirs[t] = tr
+			}
+		}
+	}
+
+	blocks := [3][]*block{commentBlocks(base, byBase), commentBlocks(ours, byOurs), commentBlocks(theirs, byTheirs)}
+	conflicting := m.conflictingBlocks(blocks, depth)
+	emitted := map[*triple]bool{}
+
+	res := []*ast.Node{} // empty children is different from nil children
+	placed := map[*triple]bool{}
+	kept := map[string]*ast.Node{} // The comment-only nodes of ours in res, by text.
+	emptyLine := false
+	i := 0 // The index of the next block of ours.
+	for _, nd := range ours {
+		tr := byOurs[nd]
+		var out *ast.Node
+		switch {
+		case nd.Deleted:
+			continue
+		case tr == nil: // Comment-only node.
+			b := blocks[oursSide][i]
+			i++
+			switch {
+			case b.text == "":
+				out = nd.Clone()
+			case has(blocks[baseSide], b.text) && !has(blocks[theirsSide], b.text):
+				// Removed by theirs.
+			case !has(blocks[baseSide], b.text) && conflicting[b.anchor] != nil:
+				// Replaced by the conflict, once for all the blocks at its anchor.
+				if !emitted[b.anchor] {
+					emitted[b.anchor] = true
+					out = conflicting[b.anchor]
+				}
+			default:
+				out = nd.Clone()
+				kept[b.text] = out
+			}
+		default:
+			placed[tr] = true
+			out = merged[tr]
+		}
+		if out == nil {
+			// Keep the empty line before a removed node, as the printer does for Deleted nodes.
+			emptyLine = emptyLine || startsWithEmptyLine(nd)
+			continue
+		}
+		if emptyLine && !startsWithEmptyLine(out) && out.Raw == "" {
+			out.PreComments = append([]string{""}, out.PreComments...)
+		}
+		emptyLine = false
+		res = append(res, out)
+	}
+	// Fields and comments added by theirs are placed after the node preceding them in theirs.
+	var prev *ast.Node
+	i = 0
+	for _, nd := range theirs {
+		tr := byTheirs[nd]
+		switch {
+		case nd.Deleted:
+		case tr == nil: // Comment-only node.
+			b := blocks[theirsSide][i]
+			i++
+			switch {
+			case kept[b.text] != nil:
+				prev = kept[b.text]
+			case b.text != "" && !has(blocks[baseSide], b.text) && !has(blocks[oursSide], b.text) && conflicting[b.anchor] == nil:
+				out := nd.Clone()
+				res = insertAfter(res, out, prev)
+				prev = out
+			}
+		case merged[tr] != nil:
+			if !placed[tr] {
+				placed[tr] = true
+				res = insertAfter(res, merged[tr], prev)
+			}
+			prev = merged[tr]
+		}
+	}
+	return res
+}
+
+// insertAfter inserts nd into nodes after prev, or before the first field if prev is nil.
+func insertAfter(nodes []*ast.Node, nd, prev *ast.Node) []*ast.Node {
+	i := len(nodes)
+	for j, c := range nodes {
+		if (prev == nil && !c.IsCommentOnly()) || c == prev {
+			i = j
+			if c == prev {
+				i++
+			}
+			break
+		}
+	}
+	nodes = append(nodes, nil)
+	copy(nodes[i+1:], nodes[i:])
+	nodes[i] = nd
+	return nodes
+}
+
+// A block is a comment-only node, which is merged as a whole.
+type block struct {
+	nd *ast.Node
+	// text holds the non-empty lines of the comments of nd, which identify the block.
+	text string
+	// anchor holds the versions of the field following the block, or nil at the end of the message.
+	anchor *triple
+}
+
+// commentBlocks returns the blocks among nodes, given the triples of the fields among them.
+func commentBlocks(nodes []*ast.Node, triples map[*ast.Node]*triple) []*block {
+	var res, pending []*block
+	for _, nd := range nodes {
+		if nd.Deleted {
+			continue
+		}
+		if tr := triples[nd]; tr != nil {
+			for _, b := range pending {
+				b.anchor = tr
+			}
+			pending = nil
+			continue
+		}
+		var lines []string
+		for _, c := range nd.PreComments {
+			if c != "" {
+				lines = append(lines, c)
+			}
+		}
+		if nd.Raw != "" {
+			lines = append(lines, nd.Raw)
+		}
+		b := &block{nd: nd, text: strings.Join(lines, "\n")}
+		res = append(res, b)
+		pending = append(pending, b)
+	}
+	return res
+}
+
+// has reports whether one of blocks has the given text.
+func has(blocks []*block, text string) bool {
+	for _, b := range blocks {
+		if b.text == text {
+			return true
+		}
+	}
+	return false
+}
+
+// conflictingBlocks returns, by anchor, the conflicts between the blocks of ours and theirs where
+// both sides replaced blocks of base with different ones.
+func (m *merger) conflictingBlocks(blocks [3][]*block, depth int) map[*triple]*ast.Node {
+	replaced := map[*triple]bool{}
+	for _, b := range blocks[baseSide] {
+		if b.text != "" && !has(blocks[oursSide], b.text) && !has(blocks[theirsSide], b.text) {
+			replaced[b.anchor] = true
+		}
+	}
+	// The comments of the blocks added by each side, by anchor.
+	var added [3]map[*triple][]string
+	for _, side := range []int{oursSide, theirsSide} {
+		added[side] = map[*triple][]string{}
+		for _, b := range blocks[side] {
+			if b.text != "" && replaced[b.anchor] && !has(blocks[baseSide], b.text) && !(side == theirsSide && has(blocks[oursSide], b.text)) {
+				added[side][b.anchor] = append(added[side][b.anchor], b.nd.PreComments...)
+			}
+		}
+	}
+	res := map[*triple]*ast.Node{}
+	for anchor, o := range added[oursSide] {
+		if t := added[theirsSide][anchor]; len(t) > 0 {
+			res[anchor] = m.conflict(&ast.Node{PreComments: o}, &ast.Node{PreComments: t}, depth)
+		}
+	}
+	return res
+}
+
+// mergeField returns the merged version of a field, or nil if it is removed.
+func (m *merger) mergeField(tr *triple, depth int) *ast.Node {
+	b, o, t := tr[baseSide], tr[oursSide], tr[theirsSide]
+	conflicts := m.conflicts
+	switch {
+	case o == nil && t == nil:
+		return nil
+	case o == nil:
+		if b == nil {
+			return t.Clone()
+		}
+		if equal(b, t) {
+			return nil
+		}
+		return m.conflict(nil, t, depth)
+	case t == nil:
+		if b == nil {
+			return o.Clone()
+		}
+		if equal(b, o) {
+			return nil
+		}
+		return m.conflict(o, nil, depth)
+	}
+	var res *ast.Node
+	switch {
+	case isMessage(o) && isMessage(t) && (b == nil || isMessage(b)):
+		var baseChildren []*ast.Node
+		if b != nil {
+			baseChildren = b.Children
+		}
+		res = o.Clone()
+		res.Children = m.mergeNodes(baseChildren, o.Children, t.Children, depth+1)
+		for _, c := range res.Children {
+			if c.Raw != "" {
+				res.ChildrenSameLine = false
+			}
+		}
+	case equal(o, t) || (b != nil && equal(b, t)):
+		res = o.Clone()
+	case b != nil && equal(b, o):
+		res = t.Clone()
+	default:
+		return m.conflict(o, t, depth)
+	}
+	if !mergeComments(res, b, o, t) {
+		// The conflicts merging the children are part of this one.
+		m.conflicts = conflicts
+		return m.conflict(o, t, depth)
+	}
+	return res
+}
+
+// conflict returns a node holding the conflicting versions of a field between conflict markers.
+func (m *merger) conflict(o, t *ast.Node, depth int) *ast.Node {
+	m.conflicts++
+	var sb strings.Builder
+	if (o != nil && startsWithEmptyLine(o)) || (o == nil && startsWithEmptyLine(t)) {
+		sb.WriteString("\n")
+	}
+	sb.WriteString(oursMarker)
+	sb.WriteString(m.pretty(o, depth))
+	sb.WriteString(sepMarker)
+	sb.WriteString(m.pretty(t, depth))
+	sb.WriteString(theirsMarker)
+	return &ast.Node{Raw: sb.String()}
+}
+
+// pretty returns the printed field at the given depth, without a leading empty line.
+func (m *merger) pretty(nd *ast.Node, depth int) string {
+	if nd == nil {
+		return ""
+	}
+	nd = nd.Clone()
+	if startsWithEmptyLine(nd) {
+		nd.PreComments = nd.PreComments[1:]
+	}
+	return string(printer.FormatNodesWithConfig([]*ast.Node{nd}, depth, m.printConfig))
+}
+
+// mergeComments sets the comments of res, the merge of o and t, to those of ours with the changes
+// of theirs, see mergeLines. It reports false if both sides changed the same comment differently.
+func mergeComments(res, b, o, t *ast.Node) bool {
+	if b == nil {
+		b = &ast.Node{}
+	}
+	var ok [4]bool
+	res.PreComments, ok[0] = mergeLines(b.PreComments, o.PreComments, t.PreComments)
+	res.PostValuesComments, ok[1] = mergeLines(b.PostValuesComments, o.PostValuesComments, t.PostValuesComments)
+	res.ClosingBraceComment, ok[2] = mergeComment(b.ClosingBraceComment, o.ClosingBraceComment, t.ClosingBraceComment)
+	ok[3] = true
+	if len(res.Values) > 0 {
+		res.Values[len(res.Values)-1].InlineComment, ok[3] = mergeComment(inlineComment(b), inlineComment(o), inlineComment(t))
+	}
+	return ok[0] && ok[1] && ok[2] && ok[3]
+}
+
+// mergeComment returns the comment changed on one side, or ours if both changed it the same way. It
+// reports false if both sides changed it differently.
+func mergeComment(base, ours, theirs string) (string, bool) {
+	switch {
+	case ours == base:
+		return theirs, true
+	case theirs == base || theirs == ours:
+		return ours, true
+	}
+	return ours, false
+}
+
+// mergeLines returns a copy of ours without the comment lines of base that theirs removed, and
+// with those that theirs added, each after the line preceding it in theirs. It reports false if
+// both sides replaced lines of base with different ones.
+func mergeLines(base, ours, theirs []string) ([]string, bool) {
+	switch {
+	case equalStrings(base, ours):
+		return append([]string(nil), theirs...), true
+	case equalStrings(base, theirs) || equalStrings(ours, theirs):
+		return append([]string(nil), ours...), true
+	}
+	inBase, inOurs, inTheirs := lineSet(base), lineSet(ours), lineSet(theirs)
+	replaced, oursAdded := false, false
+	for _, c := range base {
+		replaced = replaced || (c != "" && !inOurs[c] && !inTheirs[c])
+	}
+	for _, c := range ours {
+		oursAdded = oursAdded || (c != "" && !inBase[c])
+	}
+	var res []string
+	for _, c := range ours {
+		if c == "" || !inBase[c] || inTheirs[c] {
+			res = append(res, c)
+		}
+	}
+	var pending []string // Lines added by theirs before any line of theirs in res.
+	pos := -1            // Where to add the next line of theirs, once known.
+	for _, c := range theirs {
+		switch {
+		case c == "":
+		case inOurs[c]:
+			pos = indexOf(res, c) + 1
+			if pending != nil {
+				res = insertLines(res, pos-1, pending)
+				pos += len(pending)
+				pending = nil
+			}
+		case inBase[c]:
+		case replaced && oursAdded:
+			return append([]string(nil), ours...), false
+		case pos < 0:
+			pending = append(pending, c)
+		default:
+			res = insertLines(res, pos, []string{c})
+			pos++
+		}
+	}
+	return append(res, pending...), true
+}
+
+// lineSet returns the set of the non-empty lines.
+func lineSet(lines []string) map[string]bool {
+	res := map[string]bool{}
+	for _, c := range lines {
+		if c != "" {
+			res[c] = true
+		}
+	}
+	return res
+}
+
+func indexOf(lines []string, line string) int {
+	for i, c := range lines {
+		if c == line {
+			return i
+		}
+	}
+	return -1
+}
+
+// insertLines returns lines with added inserted at index i.
+func insertLines(lines []string, i int, added []string) []string {
+	return append(lines[:i:i], append(append([]string(nil), added...), lines[i:]...)...)
+}
+
+func inlineComment(nd *ast.Node) string {
+	if len(nd.Values) == 0 {
+		return ""
+	}
+	return nd.Values[len(nd.Values)-1].InlineComment
+}
+
+// match returns the versions of each of the fields with the given name.
+func (m *merger) match(name string, base, ours, theirs []*ast.Node) []*triple {
+	if len(base) <= 1 && len(ours) <= 1 && len(theirs) <= 1 {
+		return []*triple{{first(base), first(ours), first(theirs)}}
+	}
+	versions := [3][]*ast.Node{base, ours, theirs}
+	k, ok := m.key(name)
+	if !ok {
+		return matchByPosition(versions)
+	}
+	var res []*triple
+	byKey := map[string]*triple{}
+	var unkeyed [3][]*ast.Node
+	for side, nodes := range versions {
+		for _, nd := range nodes {
+			kv, ok := keyValue(nd, k.subfieldPath)
+			tr := byKey[kv]
+			switch {
+			case !ok || (tr != nil && tr[side] != nil):
+				unkeyed[side] = append(unkeyed[side], nd)
+			case tr == nil:
+				tr = &triple{}
+				tr[side] = nd
+				byKey[kv] = tr
+				res = append(res, tr)
+			default:
+				tr[side] = nd
+			}
+		}
+	}
+	return append(res, matchByPosition(unkeyed)...)
+}
+
+// matchByPosition matches the fields of ours and theirs to those of base by aligning the equal
+// ones. The fields in between are matched in order.
+func matchByPosition(versions [3][]*ast.Node) []*triple {
+	base := versions[baseSide]
+	var res []*triple
+	for i := range base {
+		res = append(res, &triple{base[i]})
+	}
+	var added []*triple
+	for _, side := range []int{oursSide, theirsSide} {
+		nodes := versions[side]
+		matched, extra := align(base, nodes)
+		for i, j := range matched {
+			if j >= 0 {
+				res[i][side] = nodes[j]
+			}
+		}
+	extraLoop:
+		for _, j := range extra {
+			// Fields added identically on both sides are only added once.
+			for _, tr := range added {
+				if tr[side] == nil && equal(tr[oursSide], nodes[j]) {
+					tr[side] = nodes[j]
+					continue extraLoop
+				}
+			}
+			tr := &triple{}
+			tr[side] = nodes[j]
+			added = append(added, tr)
+		}
+	}
+	return append(res, added...)
+}
+
+// align returns, for each of base, the index of the matching field of nodes or -1, and the
+// indices of the other fields of nodes.
+func align(base, nodes []*ast.Node) ([]int, []int) {
+	// lcs[i][j] is the length of the longest common subsequence of base[i:] and nodes[j:].
+	lcs := make([][]int, len(base)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(nodes)+1)
+	}
+	for i := len(base) - 1; i >= 0; i-- {
+		for j := len(nodes) - 1; j >= 0; j-- {
+			switch {
+			case equal(base[i], nodes[j]):
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	matched := make([]int, len(base))
+	var extra, removed, added []int
+	flush := func() {
+		for n, i := range removed {
+			matched[i] = -1
+			if n < len(added) {
+				matched[i] = added[n]
+			}
+		}
+		if len(added) > len(removed) {
+			extra = append(extra, added[len(removed):]...)
+		}
+		removed, added = nil, nil
+	}
+	i, j := 0, 0
+	for i < len(base) || j < len(nodes) {
+		switch {
+		case i < len(base) && j < len(nodes) && equal(base[i], nodes[j]):
+			flush()
+			matched[i] = j
+			i++
+			j++
+		case j == len(nodes) || (i < len(base) && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, i)
+			i++
+		default:
+			added = append(added, j)
+			j++
+		}
+	}
+	flush()
+	return matched, extra
+}
+
+// key returns the key of the repeated fields with the given name, if any.
+func (m *merger) key(name string) (key, bool) {
+	for _, k := range m.keys {
+		if k.field == "" || k.field == name {
+			return k, true
+		}
+	}
+	return key{}, false
+}
+
+// keyValue returns the values of the subfield at path of the message nd, as written.
+func keyValue(nd *ast.Node, path []string) (string, bool) {
+	for _, name := range path {
+		next := byName(fields(nd.Children), name)
+		if len(next) != 1 {
+			return "", false
+		}
+		nd = next[0]
+	}
+	if len(nd.Values) == 0 {
+		return "", false
+	}
+	var values []string
+	for _, v := range nd.Values {
+		values = append(values, v.Value)
+	}
+	return strings.Join(values, " "), true
+}
+
+// fields returns the fields among nodes, without comments and deleted nodes.
+func fields(nodes []*ast.Node) []*ast.Node {
+	var res []*ast.Node
+	for _, nd := range nodes {
+		if !nd.Deleted && !nd.IsCommentOnly() {
+			res = append(res, nd)
+		}
+	}
+	return res
+}
+
+func byName(nodes []*ast.Node, name string) []*ast.Node {
+	var res []*ast.Node
+	for _, nd := range nodes {
+		if nd.Name == name {
+			res = append(res, nd)
+		}
+	}
+	return res
+}
+
+func first(nodes []*ast.Node) *ast.Node {
+	if len(nodes) == 0 {
+		return nil
+	}
+	return nodes[0]
+}
+
+// isMessage reports whether nd is a message, excluding lists of messages, which are merged as a
+// whole.
+func isMessage(nd *ast.Node) bool {
+	return nd.Children != nil && !nd.ChildrenAsList
+}
+
+// equal reports whether two fields have the same content.
+func equal(a, b *ast.Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return ast.Equal([]*ast.Node{a}, []*ast.Node{b}, ast.IgnoreComments(), ast.IgnorePositions(),
+		ast.IgnoreStyle(), ast.IgnoreFieldOrder(), ast.IgnoreListStyle())
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func startsWithEmptyLine(nd *ast.Node) bool {
+	return len(nd.PreComments) > 0 && nd.PreComments[0] == ""
+}
@@ -0,0 +1,301 @@
+package merge_test
+
+import (
+	"testing"
+
+	"github.com/kylelemons/godebug/diff"
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/config"
+	"github.com/protocolbuffers/txtpbfmt/merge"
+	"github.com/protocolbuffers/txtpbfmt/parser"
+)
+
+func TestMerge(t *testing.T) {
+	inputs := []struct {
+		name          string
+		base          string
+		ours          string
+		theirs        string
+		opts          []merge.Option
+		out           string
+		wantConflicts int
+	}{{
+		name: "changes to different fields",
+		base: `# File comment.
+
+a: 1
+b: 2
+c { d: 3 }
+`,
+		ours: `# File comment.
+
+a: 10
+b: 2
+c { d: 3 }
+`,
+		theirs: `# File comment.
+
+a: 1
+# Changed by them.
+b: 20
+c { d: 3 e: 4 }
+`,
+		out: `# File comment.
+
+a: 10
+# Changed by them.
+b: 20
+c { d: 3 e: 4 }
+`,
+	}, {
+		name: "same change on both sides",
+		base: "a: 1\n",
+		ours: "a: 2  # Ours.\n",
+		theirs: `# Theirs.
+a: 2
+`,
+		out: `# Theirs.
+a: 2  # Ours.
+`,
+	}, {
+		name: "added and removed fields",
+		base: `a: 1
+b: 2
+
+c: 3
+d: 4
+`,
+		ours: `a: 1
+b: 2
+
+c: 3
+d: 4
+e: 5
+`,
+		theirs: `z: 0
+a: 1
+b: 2
+x: 6
+d: 4
+`,
+		out: `z: 0
+a: 1
+b: 2
+x: 6
+
+d: 4
+e: 5
+`,
+	}, {
+		name: "conflicting scalar change",
+		base: `job {
+  cpu: 1
+  ram: 1
+}
+`,
+		ours: `job {
+  cpu: 2
+  ram: 1
+}
+`,
+		theirs: `job {
+  cpu: 4  # More.
+  ram: 2
+}
+`,
+		out: `job {
+<<<<<<< ours
+  cpu: 2
+=======
+  cpu: 4  # More.
+>>>>>>> theirs
+  ram: 2
+}
+`,
+		wantConflicts: 1,
+	}, {
+		name:   "conflict in single-line message",
+		base:   "job { cpu: 1 }\n",
+		ours:   "job { cpu: 2 }\n",
+		theirs: "job { cpu: 3 }\n",
+		out: `job {
+<<<<<<< ours
+  cpu: 2
+=======
+  cpu: 3
+>>>>>>> theirs
+}
+`,
+		wantConflicts: 1,
+	}, {
+		name:   "removed and changed",
+		base:   "a: 1\nb: 1\n",
+		ours:   "b: 1\n",
+		theirs: "a: 2\nb: 1\n",
+		out: `<<<<<<< ours
+=======
+a: 2
+>>>>>>> theirs
+b: 1
+`,
+		wantConflicts: 1,
+	}, {
+		name: "repeated by position",
+		base: `task { id: 1 }
+task { id: 2 }
+task { id: 3 }
+`,
+		ours: `task { id: 1 cpu: 2 }
+task { id: 2 }
+task { id: 3 }
+`,
+		theirs: `task { id: 1 }
+task { id: 3 }
+task { id: 4 }
+`,
+		out: `task { id: 1 cpu: 2 }
+task { id: 3 }
+task { id: 4 }
+`,
+	}, {
+		name:   "repeated added on both sides",
+		base:   "a: 1\n",
+		ours:   "a: 1\na: 2\n",
+		theirs: "a: 1\na: 2\n",
+		out:    "a: 1\na: 2\n",
+	}, {
+		name: "repeated by key",
+		base: `job { name: "x" cpu: 1 }
+job { name: "y" cpu: 1 }
+job { name: "z" cpu: 1 }
+`,
+		ours: `job { name: "y" cpu: 2 }
+job { name: "x" cpu: 1 }
+job { name: "z" cpu: 1 }
+`,
+		theirs: `job { name: "x" cpu: 1 ram: 3 }
+job { name: "y" cpu: 1 }
+job { name: "w" cpu: 1 }
+`,
+		opts: []merge.Option{merge.KeyBySubfield("job.name")},
+		out: `job { name: "y" cpu: 2 }
+job { name: "w" cpu: 1 }
+job { name: "x" cpu: 1 ram: 3 }
+`,
+	}, {
+		name:   "lists are merged as a whole",
+		base:   "a: [1, 2]\n",
+		ours:   "a: [1, 2, 3]\n",
+		theirs: "a: [0, 1, 2]\n",
+		out: `<<<<<<< ours
+a: [1, 2, 3]
+=======
+a: [0, 1, 2]
+>>>>>>> theirs
+`,
+		wantConflicts: 1,
+	}, {
+		name: "comments added on both sides",
+		base: "a: 1\nb: 2\n",
+		ours: "# Ours.\na: 1\nb: 2\n",
+		theirs: `a: 1
+b: 2
+
+# Theirs, detached.
+
+c: 4
+`,
+		out: `# Ours.
+a: 1
+b: 2
+
+# Theirs, detached.
+
+c: 4
+`,
+	}, {
+		name:   "comment lines added on both sides",
+		base:   "# Base.\na: 1  # Base.\n",
+		ours:   "# Base.\n# Ours.\na: 1  # Base.\n",
+		theirs: "# Theirs.\n# Base.\na: 1  # Theirs.\n",
+		out:    "# Theirs.\n# Base.\n# Ours.\na: 1  # Theirs.\n",
+	}, {
+		name:   "detached comment removed by theirs",
+		base:   "# Old.\n\na: 1\n",
+		ours:   "# Old.\n\na: 2\n",
+		theirs: "a: 1\n",
+		out:    "a: 2\n",
+	}, {
+		name:   "comment replaced on both sides",
+		base:   "# Base.\na: 1\n",
+		ours:   "# Ours.\na: 1\n",
+		theirs: "# Theirs.\na: 1\n",
+		out: `<<<<<<< ours
+# Ours.
+a: 1
+=======
+# Theirs.
+a: 1
+>>>>>>> theirs
+`,
+		wantConflicts: 1,
+	}, {
+		name:   "inline comment replaced on both sides",
+		base:   "a { b: 1 }  # Base.\n",
+		ours:   "a { b: 2 }  # Ours.\n",
+		theirs: "a { b: 3 }  # Theirs.\n",
+		out: `<<<<<<< ours
+a { b: 2 }  # Ours.
+=======
+a { b: 3 }  # Theirs.
+>>>>>>> theirs
+`,
+		wantConflicts: 1,
+	}, {
+		name:   "detached comment replaced on both sides",
+		base:   "# Base.\n\na: 1\n",
+		ours:   "# Ours.\n\na: 1\n",
+		theirs: "# Theirs.\n\na: 1\n",
+		out: `<<<<<<< ours
+# Ours.
+=======
+# Theirs.
+>>>>>>> theirs
+
+a: 1
+`,
+		wantConflicts: 1,
+	}}
+	for _, input := range inputs {
+		base, ours, theirs := mustParse(t, input.base), mustParse(t, input.ours), mustParse(t, input.theirs)
+		nodes, conflicts := merge.Merge(base, ours, theirs, input.opts...)
+		if diff := diff.Diff(input.out, parser.Pretty(nodes, 0)); diff != "" {
+			t.Errorf("%s: Merge returned diff (-want, +got):\n%s", input.name, diff)
+		}
+		if conflicts != input.wantConflicts {
+			t.Errorf("%s: Merge returned %d conflicts, want %d", input.name, conflicts, input.wantConflicts)
+		}
+		if got := parser.Pretty(ours, 0); got != parser.Pretty(mustParse(t, input.ours), 0) {
+			t.Errorf("%s: Merge modified ours:\n%s", input.name, got)
+		}
+	}
+}
+
+func mustParse(t *testing.T, in string) []*ast.Node {
+	t.Helper()
+	nodes, err := parser.Parse([]byte(in))
+	if err != nil {
+		t.Fatalf("Parse(%q) returned err %v", in, err)
+	}
+	return nodes
+}
+
+func TestMergePrintConfig(t *testing.T) {
+	base, ours, theirs := mustParse(t, "job { cpu: 1 }\n"), mustParse(t, "job { cpu: 2 }\n"), mustParse(t, "job { cpu: 3 }\n")
+	c := config.Config{UseTabs: true}
+	nodes, _ := merge.Merge(base, ours, theirs, merge.PrintConfig(c))
+	want := "job {\n<<<<<<< ours\n\tcpu: 2\n=======\n\tcpu: 3\n>>>>>>> theirs\n}\n"
+	if diff := diff.Diff(want, string(parser.PrettyBytesWithConfig(nodes, 0, c))); diff != "" {
+		t.Errorf("Merge returned diff (-want, +got):\n%s", diff)
+	}
+}
@@ -25,6 +25,39 @@ const RootName = config.RootName
 // while parsing.
 type UnsortedFieldsError = sort.UnsortedFieldsError
 
+// ConfigFileName is the name of the per-directory config files read by AddConfigFilesToConfig.
+const ConfigFileName = impl.ConfigFileName
+
+// AddConfigFilesToConfig adds the settings of the config files that apply to the file at path, found
+// by walking up from its directory, to the configuration. The MetaComments of the file itself are
+// layered on top by FormatWithConfig and ParseWithConfig.
+func AddConfigFilesToConfig(path string, c *Config) error {
+	return impl.AddConfigFilesToConfig(path, c)
+}
+
+// ParseError is returned by Parse, Format and their variants for syntax errors in the input. Use
+// errors.As to access it.
+type ParseError = impl.ParseError
+
+// ParseErrors is returned by ParseWithRecovery, listing all syntax errors in the input in order.
+type ParseErrors = impl.ParseErrors
+
+// ErrorCode categorizes a ParseError.
+type ErrorCode = impl.ErrorCode
+
+// Categories of ParseError.
+const (
+	UnexpectedInput           = impl.UnexpectedInput
+	UnterminatedString        = impl.UnterminatedString
+	NewlineInString           = impl.NewlineInString
+	MissingFieldName          = impl.MissingFieldName
+	UnbalancedBracket         = impl.UnbalancedBracket
+	MultipleStringValues      = impl.MultipleStringValues
+	LoopDetected              = impl.LoopDetected
+	InvalidFormatterDirective = impl.InvalidFormatterDirective
+	UnterminatedFormatterOff  = impl.UnterminatedFormatterOff
+)
+
 // Format formats a text proto file preserving comments.
 func Format(in []byte) ([]byte, error) {
 	return printer.Format(in)
@@ -36,6 +69,12 @@ func FormatWithConfig(in []byte, c config.Config) ([]byte, error) {
 	return printer.FormatWithConfig(in, c)
 }
 
+// FormatRange functions similar to FormatWithConfig, but only formats the nodes overlapping the
+// lines from startLine to endLine (1-based, inclusive), leaving all other input untouched.
+func FormatRange(in []byte, startLine, endLine int, c Config) ([]byte, error) {
+	return printer.FormatRange(in, startLine, endLine, c)
+}
+
 // Parse returns a tree representation of a textproto file.
 func Parse(in []byte) ([]*ast.Node, error) {
 	return impl.Parse(in)
@@ -47,6 +86,14 @@ func ParseWithConfig(in []byte, c config.Config) ([]*ast.Node, error) {
 	return impl.ParseWithConfig(in, c)
 }
 
+// ParseWithRecovery functions similar to ParseWithConfig, but doesn't stop at the first syntax
+// error. The input that couldn't be parsed is kept in nodes with SyntaxError set, and the partial
+// tree is returned along with a ParseErrors listing all syntax errors. Sorting and string wrapping
+// are not applied to the tree.
+func ParseWithRecovery(in []byte, c Config) ([]*ast.Node, error) {
+	return impl.ParseWithRecovery(in, c)
+}
+
 // DebugFormat returns a textual representation of the specified nodes for
 // consumption by humans when debugging (e.g. in test failures). No guarantees
 // are made about the specific output.
@@ -63,3 +110,9 @@ func Pretty(nodes []*ast.Node, depth int) string {
 func PrettyBytes(nodes []*ast.Node, depth int) []byte {
 	return printer.FormatNodesWithDepth(nodes, depth)
 }
+
+// PrettyBytesWithConfig functions similar to PrettyBytes, but applies all printer options of c,
+// e.g. the indentation, alignment, line width, separators and canonical style.
+func PrettyBytesWithConfig(nodes []*ast.Node, depth int, c Config) []byte {
+	return printer.FormatNodesWithConfig(nodes, depth, c)
+}
@@ -4,6 +4,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/protocolbuffers/txtpbfmt/ast"
 )
 
@@ -139,3 +140,84 @@ func TestParsePositions(t *testing.T) {
 
 	}
 }
+
+func TestParseFieldAndValuePositions(t *testing.T) {
+	in := mkString(
+		"# Comment.",
+		"a: 1  # Inline.",
+		"b { c: 'x' }",
+		"d: [",
+		"  2,",
+		"  3",
+		"]",
+		"e: \"y\" \"z\";",
+		"f <",
+		"  g: [{}, {h: 4}]",
+		">",
+		"# Last.",
+		"",
+	)
+	nodes, err := Parse([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	ast.Inspect(nodes, func(_ []*ast.Node, n *ast.Node) bool {
+		got = append(got, in[n.FieldStart.Byte:n.FieldEnd.Byte])
+		for _, v := range n.Values {
+			got = append(got, "value "+in[v.Start.Byte:v.End.Byte])
+		}
+		return true
+	})
+	want := []string{
+		"a: 1", "value 1",
+		"b { c: 'x' }", "c: 'x'", "value 'x'",
+		"d: [\n  2,\n  3\n]", "value 2", "value 3",
+		`e: "y" "z"`, `value "y"`, `value "z"`,
+		"f <\n  g: [{}, {h: 4}]\n>", "g: [{}, {h: 4}]", "{}", "{h: 4}", "h: 4", "value 4",
+		"",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("field and value positions returned diff (-want, +got):\n%s", diff)
+	}
+	last := nodes[len(nodes)-1]
+	if got, want := in[last.Start.Byte:last.FieldEnd.Byte], "# Last."; got != want {
+		t.Errorf("comment-only node spans %q, want %q", got, want)
+	}
+	v := nodes[0].Values[0]
+	if got, want := v.Start, (ast.Position{Byte: 14, Line: 2, Column: 4}); got != want {
+		t.Errorf("value Start = %+v, want %+v", got, want)
+	}
+	if got, want := v.End, (ast.Position{Byte: 15, Line: 2, Column: 5}); got != want {
+		t.Errorf("value End = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseCommentStarts(t *testing.T) {
+	in := "# File.\n\njob {\n  # Name.\n  name: \"a\"  # A.\n  tags: [\"x\", # X.\n  ]\n}  # Job.\n"
+	nodes, err := Parse([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	add := func(starts []ast.Position) {
+		for _, pos := range starts {
+			line, _, _ := strings.Cut(in[pos.Byte:], "\n")
+			got = append(got, line)
+		}
+	}
+	ast.Inspect(nodes, func(_ []*ast.Node, n *ast.Node) bool {
+		add(n.CommentStarts)
+		for _, v := range n.Values {
+			add(v.CommentStarts)
+		}
+		return true
+	})
+	want := []string{"# File.", "# Job.", "# Name.", "# A.", "# X."}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("comment starts returned diff (-want, +got):\n%s", diff)
+	}
+	if got, want := nodes[1].CommentStarts[0], (ast.Position{Byte: 69, Line: 8, Column: 4}); got != want {
+		t.Errorf("closing brace comment start = %+v, want %+v", got, want)
+	}
+}
@@ -3,6 +3,7 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -31,6 +32,15 @@ func TestError(t *testing.T) {
 	}, {
 		in:  `# txtpbfmt: off`,
 		err: "unterminated txtpbfmt off",
+	}, {
+		in:  "# txtpbfmt: indent_width=\na: 1",
+		err: `error parsing indent_width value ""`,
+	}, {
+		in:  "# txtpbfmt: indent_width=four\na: 1",
+		err: `error parsing indent_width value "four"`,
+	}, {
+		in:  "# txtpbfmt: indent_width\na: 1",
+		err: "format should be indent_width=<int>, got: indent_width",
 	}}
 	for _, input := range inputs {
 		out, err := Format([]byte(input.in))
@@ -50,6 +60,293 @@ func TestError(t *testing.T) {
 	}
 }
 
+func TestParseWithRecovery(t *testing.T) {
+	inputs := []struct {
+		name     string
+		in       string
+		wantErrs []string
+		out      string
+	}{{
+		name: "no errors",
+		in:   "a:1\n",
+		out:  "a: 1\n",
+	}, {
+		name: "errors at several levels",
+		in: `a:1
+b {}}
+c {
+  d: "x
+  e:2
+  f:: 1 { g: 1
+  h: 2 }
+  {}
+}
+j: ["a" "b"]
+k {
+  l: 1
+`,
+		wantErrs: []string{
+			`2:5: unexpected '}' without matching opening bracket`,
+			`4:8: found literal (unescaped) new line in string`,
+			`6:6: parser encountered unexpected character ':'`,
+			`8:3: Failed to find a FieldName`,
+			`10:12: multiple-string value not supported`,
+			`11:3: missing closing bracket for "k"`,
+		},
+		// The input that couldn't be parsed is kept as is.
+		out: `a: 1
+b {}
+}
+c {
+  d: "x
+  e: 2
+  f:: 1 { g: 1
+  h: 2 }
+  {}
+}
+j: ["a" "b"]
+k {
+  l: 1
+}
+`,
+	}}
+	for _, input := range inputs {
+		nodes, err := ParseWithRecovery([]byte(input.in), Config{})
+		var errs ParseErrors
+		if err != nil && !errors.As(err, &errs) {
+			t.Errorf("ParseWithRecovery[%s] returned err %v, want ParseErrors", input.name, err)
+			continue
+		}
+		if len(errs) != len(input.wantErrs) {
+			t.Errorf("ParseWithRecovery[%s] returned errors:\n%v\nwant:\n%s", input.name, err, strings.Join(input.wantErrs, "\n"))
+		} else {
+			for i, e := range errs {
+				if got := fmt.Sprintf("%d:%d: %s", e.Pos.Line, e.Pos.Column, e.Msg); !strings.HasPrefix(got, input.wantErrs[i]) {
+					t.Errorf("ParseWithRecovery[%s] error %d = %q, want prefix %q", input.name, i, got, input.wantErrs[i])
+				}
+			}
+		}
+		if diff := diff.Diff(input.out, Pretty(nodes, 0)); diff != "" {
+			t.Errorf("ParseWithRecovery[%s] returned different Pretty output from expected (-want, +got):\n%s", input.name, diff)
+		}
+	}
+}
+
+func TestFormatRange(t *testing.T) {
+	in := `a:1
+b :  2
+
+
+# Comment for c.
+c {
+  d:3
+  e {f:4}
+
+  g:  5
+}
+h:6 i:7
+j: [ {k:8}, {k:9} ]
+`
+	inputs := []struct {
+		name               string
+		in                 string // Defaults to the input above.
+		startLine, endLine int
+		config             Config
+		out                string
+	}{{
+		name:      "whole file",
+		startLine: 1,
+		endLine:   14,
+		out: `a: 1
+b: 2
+
+# Comment for c.
+c {
+  d: 3
+  e { f: 4 }
+
+  g: 5
+}
+h: 6
+i: 7
+j: [ { k: 8 }, { k: 9 } ]
+`,
+	}, {
+		name:      "single line",
+		startLine: 2,
+		endLine:   2,
+		out: `a:1
+b: 2
+
+
+# Comment for c.
+c {
+  d:3
+  e {f:4}
+
+  g:  5
+}
+h:6 i:7
+j: [ {k:8}, {k:9} ]
+`,
+	}, {
+		// The lines up to the opening bracket of a multi-line message are formatted without its children.
+		name:      "comment of message",
+		startLine: 5,
+		endLine:   5,
+		out: `a:1
+b :  2
+
+# Comment for c.
+c {
+  d:3
+  e {f:4}
+
+  g:  5
+}
+h:6 i:7
+j: [ {k:8}, {k:9} ]
+`,
+	}, {
+		name: "header of message",
+		in: `a:1
+foo   :{
+    b:   2
+}
+z:  4
+`,
+		startLine: 2,
+		endLine:   2,
+		out: `a:1
+foo: {
+    b:   2
+}
+z:  4
+`,
+	}, {
+		name: "closing bracket of message",
+		in: `foo {
+    b:   2
+  }  # Foo.
+`,
+		startLine: 3,
+		endLine:   3,
+		out: `foo {
+    b:   2
+}  # Foo.
+`,
+	}, {
+		name:      "header and children of message",
+		startLine: 6,
+		endLine:   7,
+		out: `a:1
+b :  2
+
+# Comment for c.
+c {
+  d: 3
+  e {f:4}
+
+  g:  5
+}
+h:6 i:7
+j: [ {k:8}, {k:9} ]
+`,
+	}, {
+		name:      "children of message",
+		startLine: 8,
+		endLine:   10,
+		out: `a:1
+b :  2
+
+
+# Comment for c.
+c {
+  d:3
+  e { f: 4 }
+
+  g: 5
+}
+h:6 i:7
+j: [ {k:8}, {k:9} ]
+`,
+	}, {
+		name:      "nodes on the same line",
+		startLine: 12,
+		endLine:   12,
+		out: `a:1
+b :  2
+
+
+# Comment for c.
+c {
+  d:3
+  e {f:4}
+
+  g:  5
+}
+h: 6
+i: 7
+j: [ {k:8}, {k:9} ]
+`,
+	}, {
+		name:      "list of messages",
+		startLine: 13,
+		endLine:   13,
+		out: `a:1
+b :  2
+
+
+# Comment for c.
+c {
+  d:3
+  e {f:4}
+
+  g:  5
+}
+h:6 i:7
+j: [ { k: 8 }, { k: 9 } ]
+`,
+	}, {
+		name:      "sorting within the formatted nodes",
+		startLine: 7,
+		endLine:   10,
+		config:    Config{SortFieldsByFieldName: true},
+		out: `a:1
+b :  2
+
+
+# Comment for c.
+c {
+  d: 3
+  e { f: 4 }
+
+  g: 5
+}
+h:6 i:7
+j: [ {k:8}, {k:9} ]
+`,
+	}, {
+		name:      "no nodes in range",
+		startLine: 20,
+		endLine:   30,
+		out:       in,
+	}}
+	for _, input := range inputs {
+		if input.in == "" {
+			input.in = in
+		}
+		out, err := FormatRange([]byte(input.in), input.startLine, input.endLine, input.config)
+		if err != nil {
+			t.Errorf("FormatRange[%s] returned err %v", input.name, err)
+			continue
+		}
+		if diff := diff.Diff(input.out, string(out)); diff != "" {
+			t.Errorf("FormatRange[%s] returned diff (-want, +got):\n%s", input.name, diff)
+		}
+	}
+}
+
 func TestDisable(t *testing.T) {
 	inputs := []string{
 		`#txtpbfmt:disable
@@ -1474,6 +1771,29 @@ presubmit: {
     type: type_1
   }
 }
+`}, {
+		name: "remove duplicates keeps empty line",
+		in: `# txtpbfmt: remove_duplicate_values_for_repeated_fields
+a: 1
+b {
+  c: 2
+
+  c: 2
+  d: 3
+}
+
+a: 1
+e: 4
+`,
+		out: `# txtpbfmt: remove_duplicate_values_for_repeated_fields
+a: 1
+b {
+  c: 2
+
+  d: 3
+}
+
+e: 4
 `}, {
 		name: "sort and remove duplicates",
 		in: `# txtpbfmt: sort_fields_by_field_name
@@ -1807,6 +2127,72 @@ a, b,
   c
   # txtpbfmt: on
 ]
+`}, {
+		name: "indent_width and use_tabs",
+		in: `# txtpbfmt: indent_width=4
+a {
+  b { c: 1 }
+  d {
+    e: 2
+  }
+}
+`,
+		out: `# txtpbfmt: indent_width=4
+a {
+    b { c: 1 }
+    d {
+        e: 2
+    }
+}
+`}, {
+		name: "use_tabs",
+		in: `# txtpbfmt: use_tabs
+a {
+  b: 1
+}
+`,
+		out: "# txtpbfmt: use_tabs\na {\n\tb: 1\n}\n"}, {
+		name: "align_values and align_comments",
+		in: `# txtpbfmt: align_values, align_comments
+a: 1  # A.
+bbb: 22  # B.
+`,
+		out: `# txtpbfmt: align_values, align_comments
+a:   1   # A.
+bbb: 22  # B.
+`}, {
+		name: "separators and colons_before_messages",
+		in: `# txtpbfmt: separators=preserve, colons_before_messages
+a { b: 1; c: 2, }
+`,
+		out: `# txtpbfmt: separators=preserve, colons_before_messages
+a: { b: 1; c: 2, }
+`}, {
+		name: "canonical",
+		in: `# txtpbfmt: canonical=cpp
+a: [0x1, 2]
+b: { c: 'x' }
+`,
+		out: `# txtpbfmt: canonical=cpp
+a: 1
+a: 2
+b {
+  c: "x"
+}
+`}, {
+		name: "max_line_width",
+		in: `# txtpbfmt: max_line_width=20
+a {
+  b: 1
+}
+c { d: 1 e: "long value" }
+`,
+		out: `# txtpbfmt: max_line_width=20
+a { b: 1 }
+c {
+  d: 1
+  e: "long value"
+}
 `}, {
 		name: "carriage return \\r is formatted away",
 		in:   `foo: "bar"` + "\r" + `baz: "bat"` + "\r",
@@ -1838,6 +2224,9 @@ func TestParserConfigs(t *testing.T) {
 		config  config.Config
 		out     string
 		wantErr string
+		// Whether to print the nodes of ParseWithConfig with PrettyBytesWithConfig rather than Pretty,
+		// which ignores the options of config applied by the printer.
+		prettyWithConfig bool
 	}{{
 		name: "AlreadyExpandedConfigOff",
 		in: `presubmit: {
@@ -2296,6 +2685,43 @@ below_wrapper: true
 			RequireFieldSortOrderToMatchAllFieldsInNode: true,
 		},
 		wantErr: `parent field: "check_contents", unsorted field: "unknown_field_triggers_error"`,
+	}, {
+		name: "SortBySpecifiedFieldOrderFromMetaComment",
+		in: `# txtpbfmt: sort_fields_by_field_name=false, field_order=job:name,owner,schedule
+# txtpbfmt: field_order=task:id,cpu
+job: {
+  schedule: "daily"
+  unknown_bubbles_to_top: true
+  task: { cpu: 2 id: 1 }
+  owner: "me"
+  name: "backup"
+}
+`,
+		out: `# txtpbfmt: sort_fields_by_field_name=false, field_order=job:name,owner,schedule
+# txtpbfmt: field_order=task:id,cpu
+job: {
+  unknown_bubbles_to_top: true
+  task: { id: 1 cpu: 2 }
+  name: "backup"
+  owner: "me"
+  schedule: "daily"
+}
+`,
+	}, {
+		name: "SortBySpecifiedFieldOrderFromMetaCommentErrorHandling",
+		in: `# txtpbfmt: require_field_sort_order_to_match_all_fields_in_node
+# txtpbfmt: field_order=job:name,owner,schedule
+job: {
+  schedule: "daily"
+  unknown_field_triggers_error: true
+  owner: "me"
+}
+`,
+		wantErr: `parent field: "job", unsorted field: "unknown_field_triggers_error"`,
+	}, {
+		name:    "FieldOrderMetaCommentWithoutNodeName",
+		in:      "# txtpbfmt: field_order=name,owner\nname: \"a\"\n",
+		wantErr: "field order should be",
 	}, {
 		name: "RemoveRepeats",
 		in: `presubmit: {
@@ -2430,6 +2856,24 @@ s:
   "one two "
   "three four "
   "five"
+`,
+	}, {
+		name:             "WrapStringsAtColumn_indentWidth",
+		prettyWithConfig: true,
+		config: config.Config{
+			WrapStringsAtColumn: 19,
+			IndentWidth:         4,
+		},
+		in: `root {
+  s: "one two three four"
+}
+`,
+		out: `root {
+    s:
+        "one two "
+        "three "
+        "four"
+}
 `,
 	}, {
 		name: "WrapStringsAtColumn_inlineChildren",
@@ -2957,6 +3401,446 @@ foo: '"bar"'
 		name: "carriage returns",
 		in:   "a{\r\n}\r\n",
 		out:  "a {\n}\n",
+	}, {
+		name:             "IndentWidth",
+		prettyWithConfig: true,
+		config:           config.Config{IndentWidth: 4},
+		in: `a {
+  # Comment.
+  b: [1, 2]
+  c: [
+    3,  # Three.
+    4
+  ]  # C.
+  d { e: 5 }
+  f: [ { g: 6 }, { g: 7 } ]
+  h: [
+    { i: 8 },
+    { i: 9 }
+  ]
+}
+`,
+		out: `a {
+    # Comment.
+    b: [1, 2]
+    c: [
+        3,  # Three.
+        4
+    ]  # C.
+    d { e: 5 }
+    f: [ { g: 6 }, { g: 7 } ]
+    h: [
+        { i: 8 },
+        { i: 9 }
+    ]
+}
+`,
+	}, {
+		name:             "UseTabs",
+		prettyWithConfig: true,
+		config:           config.Config{UseTabs: true, IndentWidth: 4},
+		in: `a {
+  b {
+    c: [
+      1
+    ]
+  }
+}
+`,
+		out: "a {\n\tb {\n\t\tc: [\n\t\t\t1\n\t\t]\n\t}\n}\n",
+	}, {
+		name:             "MaxLineWidth",
+		prettyWithConfig: true,
+		config:           config.Config{MaxLineWidth: 20},
+		in: `a {
+  b {
+    c: 1
+  }
+  d: [
+    1, 2
+  ]
+  e {}
+  f {
+  }
+  g { h: 1 i: "long value" }
+  j: [{ k: 1 }, { k: 2 }, { k: 3 }]
+  l {
+    m: 1  # Comment.
+  }
+  n {
+    # Comment.
+    o: 1
+  }
+  p: [1,  # One.
+    2]
+}
+q { r: 12345678901 }
+s { t: 123456789012 }
+`,
+		out: `a {
+  b { c: 1 }
+  d: [1, 2]
+  e {}
+  f {}
+  g {
+    h: 1
+    i: "long value"
+  }
+  j: [
+    { k: 1 },
+    { k: 2 },
+    { k: 3 }
+  ]
+  l {
+    m: 1  # Comment.
+  }
+  n {
+    # Comment.
+    o: 1
+  }
+  p: [
+    1,  # One.
+    2
+  ]
+}
+q { r: 12345678901 }
+s {
+  t: 123456789012
+}
+`,
+	}, {
+		name:             "AlignValues",
+		prettyWithConfig: true,
+		config:           config.Config{AlignValues: true},
+		in: `a: 1
+bbb: "x"  # X.
+list: [1, 2]
+msg { c: 1 }
+multi: "y"
+  "z"
+skip_colon { d: 1 }
+
+# Comment.
+e: 1
+ffff: 2
+# Comment-only node.
+
+g: 1
+hh {
+  i: 1
+  jjj: 2
+}
+`,
+		out: `a:    1
+bbb:  "x"  # X.
+list: [1, 2]
+msg { c: 1 }
+multi:
+  "y"
+  "z"
+skip_colon { d: 1 }
+
+# Comment.
+e:    1
+ffff: 2
+# Comment-only node.
+
+g: 1
+hh {
+  i:   1
+  jjj: 2
+}
+`,
+	}, {
+		name:             "AlignComments",
+		prettyWithConfig: true,
+		config:           config.Config{AlignComments: true},
+		in: `a: 1  # A.
+bbb: "x"  # X.
+c: 1
+list: [1, 2]  # List.
+msg { d: 1 }  # Msg.
+multi {
+  e: 1
+}  # Multi.
+f: 1 # F.
+
+g: 1  # G.
+hhhh: 1  # H.
+items: [
+  { i: 1 },  # I.
+  { jjj: 2 }  # J.
+]
+`,
+		out: `a: 1          # A.
+bbb: "x"      # X.
+c: 1
+list: [1, 2]  # List.
+msg { d: 1 }  # Msg.
+multi {
+  e: 1
+}  # Multi.
+f: 1          # F.
+
+g: 1     # G.
+hhhh: 1  # H.
+items: [
+  { i: 1 },   # I.
+  { jjj: 2 }  # J.
+]
+`,
+	}, {
+		name:             "AlignValuesAndComments",
+		prettyWithConfig: true,
+		config:           config.Config{AlignValues: true, AlignComments: true},
+		in: `a: 1  # A.
+bbb: 22  # B.
+`,
+		out: `a:   1   # A.
+bbb: 22  # B.
+`,
+	}, {
+		name:   "ColonsBeforeMessages",
+		config: config.Config{ColonsBeforeMessages: true},
+		in: `a { b: 1 }
+c: { d <> }
+e [{ f: 1 }]
+g 1
+`,
+		out: `a: { b: 1 }
+c: { d: {} }
+e: [ { f: 1 } ]
+g 1
+`,
+	}, {
+		name:   "ColonsBeforeMessages_skipAllColons",
+		config: config.Config{ColonsBeforeMessages: true, SkipAllColons: true},
+		in: `a: { b: 1 }
+`,
+		out: `a { b: 1 }
+`,
+	}, {
+		name:   "ColonsBeforeScalars",
+		config: config.Config{ColonsBeforeScalars: true},
+		in: `a 1
+b "x"
+  "y"
+c [1, 2]
+d { e 1 }
+`,
+		out: `a: 1
+b:
+  "x"
+  "y"
+c: [1, 2]
+d { e: 1 }
+`,
+	}, {
+		name: "Separators_remove",
+		in: `a { b: 1, c: 2; d { e: 3, }, }
+f: 1,
+`,
+		out: `a { b: 1 c: 2 d { e: 3 } }
+f: 1
+`,
+	}, {
+		name:             "Separators_preserve",
+		prettyWithConfig: true,
+		config:           config.Config{Separators: config.PreserveSeparators},
+		in: `a { b: 1, c: 2; d { e: 3, }, f: [1, 2]; g: [{ h: 4 }, { h: 5 }] }
+i: 1,
+j {
+  k: 2;
+}
+`,
+		out: `a { b: 1, c: 2; d { e: 3, }, f: [1, 2]; g: [ { h: 4 }, { h: 5 } ] }
+i: 1
+j {
+  k: 2
+}
+`,
+	}, {
+		name:             "Separators_comma",
+		prettyWithConfig: true,
+		config:           config.Config{Separators: config.CommaSeparators},
+		in: `a { b: 1; c: 2 d { e: 3; } }
+f { g: [{ h: 4 }, { h: 5 }] }
+i {
+  j: 1
+  k: 2
+}
+`,
+		out: `a { b: 1, c: 2, d { e: 3 } }
+f { g: [ { h: 4 }, { h: 5 } ] }
+i {
+  j: 1
+  k: 2
+}
+`,
+	}, {
+		name:             "Separators_semicolon",
+		prettyWithConfig: true,
+		config:           config.Config{Separators: config.SemicolonSeparators},
+		in: `a { b: 1, c: 2 }
+`,
+		out: `a { b: 1; c: 2 }
+`,
+	}, {
+		name:             "Separators_maxLineWidth",
+		prettyWithConfig: true,
+		config:           config.Config{Separators: config.CommaSeparators, MaxLineWidth: 17},
+		in: `a { b: 1 c: 22 }
+d { e: 1 f: 222 }
+`,
+		out: `a { b: 1, c: 22 }
+d {
+  e: 1
+  f: 222
+}
+`,
+	}, {
+		name:    "SeparatorsMetaCommentWithUnknownStyle",
+		in:      "# txtpbfmt: separators=tab\na: 1\n",
+		wantErr: "separators should be",
+	}, {
+		name:             "Canonical_cpp",
+		prettyWithConfig: true,
+		config:           config.Config{Canonical: config.CanonicalCpp, IndentWidth: 4, Separators: config.CommaSeparators},
+		in: `# Header.
+name: 'it\'s "quoted"'  # Name.
+bytes: "caf\303\251 \x01"
+unicode: "caf\u00e9 \U0001F600 \x41\101"
+id: 0x1F
+octal: 017
+ratio: 1.50
+big: 1e6
+small: 1e-5
+third: 0.3333333333333333
+special: -inf
+enum: VALUE
+ints: [1, 2,
+  # Three.
+  3]  # Ints.
+empty: []
+nested <
+  inner { a: 1; b: 2 }
+  list: [{ x: 1 }, { x: 2 }]  # List.
+  e {}
+>
+long: "a"  # A.
+  "b"  # B.
+`,
+		out: `# Header.
+name: "it\'s \"quoted\""  # Name.
+bytes: "caf\303\251 \001"
+unicode: "caf\303\251 \360\237\230\200 AA"
+id: 31
+octal: 15
+ratio: 1.5
+big: 1000000
+small: 1e-05
+third: 0.33333333333333331
+special: -inf
+enum: VALUE
+ints: 1
+ints: 2
+# Three.
+ints: 3  # Ints.
+nested {
+  inner {
+    a: 1
+    b: 2
+  }
+  list {
+    x: 1
+  }
+  list {
+    x: 2
+  }  # List.
+  e {
+  }
+}
+# A.
+long: "ab"  # B.
+`,
+	}, {
+		name:             "Canonical_go",
+		prettyWithConfig: true,
+		config:           config.Config{Canonical: config.CanonicalGo},
+		in: `name: 'it\'s "quoted"'
+bytes: "caf\303\251 \x01\x7f\302\205\377"
+unicode: "caf\u00e9 \U0001F600 \x41\101"
+big: 1e6
+third: 0.3333333333333333
+nested {
+  inner { a: 1 }
+  e {}
+}
+`,
+		out: `name: "it's \"quoted\""
+bytes: "café \x01\x7f\u0085\xff"
+unicode: "café 😀 AA"
+big: 1e+06
+third: 0.3333333333333333
+nested: {
+  inner: {
+    a: 1
+  }
+  e: {}
+}
+`,
+	}, {
+		name:             "RemoveComments",
+		prettyWithConfig: true,
+		config:           config.Config{RemoveComments: true},
+		in: `# Header.
+
+# Comment.
+a: 1  # A.
+b {
+  # C.
+  c: [
+    # One.
+    1,
+    2  # Two.
+    # End.
+  ]  # Closing.
+  # Last.
+}
+`,
+		out: `a: 1
+b {
+  c: [
+    1,
+    2
+  ]
+}
+`,
+	}, {
+		name:             "RemoveComments_canonical",
+		prettyWithConfig: true,
+		config:           config.Config{RemoveComments: true, Canonical: config.CanonicalCpp},
+		in: `# Header.
+
+a: [1, 2]  # A.
+b {}
+`,
+		out: `a: 1
+a: 2
+b {
+}
+`,
+	}, {
+		name:   "MaxLineWidth_ignoredWithExpandAllChildren",
+		config: config.Config{MaxLineWidth: 80, ExpandAllChildren: true},
+		in: `a {
+  b: 1
+}
+`,
+		out: `a {
+  b: 1
+}
+`,
 	},
 	}
 	// Test FormatWithConfig with inputs.
@@ -2998,12 +3882,60 @@ foo: '"bar"'
 			continue
 		}
 		got := Pretty(nodes, 0)
+		if input.prettyWithConfig {
+			got = string(PrettyBytesWithConfig(nodes, 0, input.config))
+		}
 		if diff := diff.Diff(input.out, got); diff != "" {
 			t.Errorf("ParseWithConfig[%s](\n%s\n)\nreturned different Pretty output from expected (-want, +got):\n%s", input.name, input.in, diff)
 		}
 	}
 }
 
+func TestPrettyBytesWithConfig(t *testing.T) {
+	in := "a {\n  b: 1\n  c { d: 2 }\n}\n"
+	inputs := []struct {
+		name   string
+		config Config
+		depth  int
+		want   string
+	}{{
+		name: "default",
+		want: in,
+	}, {
+		name:   "IndentWidth",
+		config: Config{IndentWidth: 4},
+		want:   "a {\n    b: 1\n    c { d: 2 }\n}\n",
+	}, {
+		name:   "UseTabs",
+		config: Config{UseTabs: true},
+		want:   "a {\n\tb: 1\n\tc { d: 2 }\n}\n",
+	}, {
+		name:   "IndentWidth at depth",
+		config: Config{IndentWidth: 4},
+		depth:  1,
+		want:   "    a {\n        b: 1\n        c { d: 2 }\n    }\n",
+	}, {
+		name:   "UseTabs at depth",
+		config: Config{UseTabs: true},
+		depth:  1,
+		want:   "\ta {\n\t\tb: 1\n\t\tc { d: 2 }\n\t}\n",
+	}, {
+		name:   "other printer options",
+		config: Config{MaxLineWidth: 80, Separators: config.CommaSeparators},
+		want:   "a { b: 1, c { d: 2 } }\n",
+	}}
+	for _, input := range inputs {
+		nodes, err := Parse([]byte(in))
+		if err != nil {
+			t.Fatalf("Parse returned err %v", err)
+		}
+		got := string(PrettyBytesWithConfig(nodes, input.depth, input.config))
+		if diff := diff.Diff(input.want, got); diff != "" {
+			t.Errorf("PrettyBytesWithConfig[%s] returned diff (-want, +got):\n%s", input.name, diff)
+		}
+	}
+}
+
 func TestDebugFormat(t *testing.T) {
 	inputs := []struct {
 		in   string
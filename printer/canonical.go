@@ -0,0 +1,260 @@
+package printer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/config"
+	"github.com/protocolbuffers/txtpbfmt/unquote"
+)
+
+// withoutComments returns nodes without comment-only nodes, and removes the comments of the other
+// nodes in place.
+func withoutComments(nodes []*ast.Node) []*ast.Node {
+	res := make([]*ast.Node, 0, len(nodes)) // Messages keep non-nil children.
+	for _, nd := range nodes {
+		if nd.Raw == "" && nd.IsCommentOnly() {
+			continue
+		}
+		nd.PreComments, nd.PostValuesComments, nd.ClosingBraceComment = nil, nil, ""
+		for _, v := range nd.Values {
+			v.PreComments, v.InlineComment = nil, ""
+		}
+		if nd.Children != nil {
+			nd.Children = withoutComments(nd.Children)
+		}
+		res = append(res, nd)
+	}
+	return res
+}
+
+// canonicalNodes returns nodes in the layout of the given style, see config.CanonicalStyle. Lists
+// are replaced by a node for each of their values or messages; other nodes are modified in place.
+func canonicalNodes(nodes []*ast.Node, style config.CanonicalStyle) []*ast.Node {
+	res := make([]*ast.Node, 0, len(nodes))
+	for _, nd := range nodes {
+		if nd.IsCommentOnly() { // Also for nodes with formatting disabled.
+			res = append(res, nd)
+			continue
+		}
+		nd.IsAngleBracket, nd.PutSingleValueOnNextLine, nd.Separator = false, false, ""
+		switch {
+		case nd.ChildrenAsList:
+			res = append(res, canonicalNodes(expandMessageList(nd), style)...)
+		case nd.Children != nil:
+			nd.Children = canonicalNodes(nd.Children, style)
+			nd.SkipColon = style == config.CanonicalCpp
+			nd.ChildrenSameLine = style == config.CanonicalGo && len(nd.Children) == 0
+			res = append(res, nd)
+		case nd.ValuesAsList:
+			res = append(res, canonicalNodes(expandValueList(nd), style)...)
+		default:
+			canonicalScalar(nd, style)
+			res = append(res, nd)
+		}
+	}
+	return res
+}
+
+// expandMessageList returns a message field for each message of a list of messages.
+func expandMessageList(nd *ast.Node) []*ast.Node {
+	var res []*ast.Node
+	for _, item := range nd.Children {
+		if !item.IsCommentOnly() {
+			item.Name = nd.Name
+		}
+		res = append(res, item)
+	}
+	return withListComments(nd, res)
+}
+
+// expandValueList returns a scalar field for each value of a list of values.
+func expandValueList(nd *ast.Node) []*ast.Node {
+	var res []*ast.Node
+	for _, v := range nd.Values {
+		res = append(res, &ast.Node{Name: nd.Name, PreComments: v.PreComments, Values: []*ast.Value{v}})
+		v.PreComments = nil
+	}
+	return withListComments(nd, res)
+}
+
+// withListComments attaches the comments of the list nd to the fields it's expanded to: those before
+// the list to the first field, the comment after the closing bracket to the last field if it has no
+// trailing comment, and the remaining ones to a comment-only node after the fields.
+func withListComments(nd *ast.Node, fields []*ast.Node) []*ast.Node {
+	post := nd.PostValuesComments
+	if c := nd.ClosingBraceComment; c != "" {
+		if last := lastField(fields); last != nil && last.Children != nil && last.ClosingBraceComment == "" {
+			last.ClosingBraceComment = c
+		} else if last != nil && last.Children == nil && last.Values[len(last.Values)-1].InlineComment == "" {
+			last.Values[len(last.Values)-1].InlineComment = c
+		} else {
+			post = append(post[:len(post):len(post)], c)
+		}
+	}
+	if len(fields) == 0 {
+		fields = []*ast.Node{{}}
+	}
+	fields[0].PreComments = append(nd.PreComments[:len(nd.PreComments):len(nd.PreComments)], fields[0].PreComments...)
+	if len(post) > 0 {
+		fields = append(fields, &ast.Node{PreComments: post})
+	}
+	if len(fields) == 1 && fields[0].IsCommentOnly() && len(fields[0].PreComments) == 0 {
+		return nil // An empty list without comments.
+	}
+	return fields
+}
+
+// lastField returns the last of nodes that isn't comment-only, or nil if there is none.
+func lastField(nodes []*ast.Node) *ast.Node {
+	for i := len(nodes) - 1; i >= 0; i-- {
+		if !nodes[i].IsCommentOnly() {
+			return nodes[i]
+		}
+	}
+	return nil
+}
+
+// canonicalScalar writes the value of a scalar field in the given style, on the line of its name.
+// A string split into several values is joined into one. The comments before the values are moved
+// before the field, and so are the inline comments of all values but the last.
+func canonicalScalar(nd *ast.Node, style config.CanonicalStyle) {
+	nd.SkipColon = false
+	for _, v := range nd.Values {
+		nd.PreComments = append(nd.PreComments, v.PreComments...)
+		v.PreComments = nil
+	}
+	for _, v := range nd.Values {
+		if strings.HasPrefix(v.Value, `"""`) || strings.HasPrefix(v.Value, `'''`) {
+			return // Triple-quoted strings have no canonical form.
+		}
+	}
+	s, _, err := unquote.Unquote(nd)
+	if err != nil {
+		// Not a string.
+		for _, v := range nd.Values {
+			v.Value = canonicalNumber(v.Value, style)
+		}
+		return
+	}
+	v := &ast.Value{Value: quoteString(s, style), Start: nd.Values[0].Start, End: nd.Values[len(nd.Values)-1].End}
+	for _, w := range nd.Values {
+		if w.InlineComment != "" {
+			if v.InlineComment != "" {
+				nd.PreComments = append(nd.PreComments, v.InlineComment)
+			}
+			v.InlineComment = w.InlineComment
+		}
+	}
+	nd.Values = []*ast.Value{v}
+}
+
+// canonicalNumber returns the literal of a hexadecimal or octal integer in decimal, and that of a
+// floating-point number as written by the given style. Other literals are returned unchanged.
+func canonicalNumber(lit string, style config.CanonicalStyle) string {
+	digits := strings.TrimPrefix(lit, "-")
+	if digits == "" || !(digits[0] == '.' || '0' <= digits[0] && digits[0] <= '9') {
+		return lit // An identifier, e.g. an enum value, true or inf.
+	}
+	if strings.Trim(digits, "0123456789") == "" && (digits == "0" || digits[0] != '0') {
+		return lit // A decimal integer, which may be the value of a floating-point field, e.g. -0.
+	}
+	v := &ast.Value{Value: lit}
+	if i, err := v.AsInt64(); err == nil {
+		return strconv.FormatInt(i, 10)
+	}
+	if u, err := v.AsUint64(); err == nil {
+		return strconv.FormatUint(u, 10)
+	}
+	f, err := v.AsFloat64()
+	if err != nil {
+		return lit
+	}
+	if style == config.CanonicalCpp {
+		return cppFloat(f)
+	}
+	return ast.FloatValue(f).Value
+}
+
+// cppFloat returns the literal of a double as written by the C++ printer: with 15 significant
+// digits, or 17 if those don't read back as f.
+func cppFloat(f float64) string {
+	lit := ast.FloatValue(f).Value
+	if lit == "inf" || lit == "-inf" || lit == "nan" {
+		return lit
+	}
+	// Go's 'g' format uses an exponent in the same cases as C's %g.
+	lit = strconv.FormatFloat(f, 'g', 15, 64)
+	if g, err := strconv.ParseFloat(lit, 64); err != nil || g != f {
+		lit = strconv.FormatFloat(f, 'g', 17, 64)
+	}
+	return lit
+}
+
+// quoteString returns the double-quoted literal of s as written by the given style.
+func quoteString(s string, style config.CanonicalStyle) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	if style == config.CanonicalCpp {
+		writeCppEscaped(&b, s)
+	} else {
+		writeGoEscaped(&b, s)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// writeCppEscaped writes s escaped as by CEscape in C++: bytes that aren't printable ASCII are
+// written as octal escapes.
+func writeCppEscaped(b *strings.Builder, s string) {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '"', '\'', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(b, `\%03o`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+}
+
+// writeGoEscaped writes s escaped as by prototext in Go: valid UTF-8 is kept, except for control
+// characters, and invalid bytes are written as hexadecimal escapes.
+func writeGoEscaped(b *strings.Builder, s string) {
+	for len(s) > 0 {
+		r, n := utf8.DecodeRuneInString(s)
+		switch {
+		case r == utf8.RuneError && n == 1:
+			fmt.Fprintf(b, `\x%02x`, s[0])
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < ' ' || r == 0x7f:
+			fmt.Fprintf(b, `\x%02x`, r)
+		case r >= utf8.RuneSelf && r <= 0x9f:
+			fmt.Fprintf(b, `\u%04x`, r)
+		default:
+			b.WriteString(s[:n])
+		}
+		s = s[n:]
+	}
+}
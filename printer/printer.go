@@ -5,13 +5,15 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/protocolbuffers/txtpbfmt/ast"
 	"github.com/protocolbuffers/txtpbfmt/config"
 	"github.com/protocolbuffers/txtpbfmt/impl"
 )
 
-const indentSpaces = "  "
+// commentSpacing separates inline comments from what precedes them on their line.
+const commentSpacing = "  "
 
 // Format formats a text proto file preserving comments.
 func Format(in []byte) ([]byte, error) {
@@ -32,12 +34,10 @@ func FormatWithConfig(in []byte, c config.Config) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return FormatNodes(nodes), nil
+	return FormatNodesWithConfig(nodes, 0 /* depth */, c), nil
 }
 
 func removeDeleted(nodes []*ast.Node) []*ast.Node {
-	var res []*ast.Node
-	res = []*ast.Node{} // empty children is different from nil children
 	// When removing a node which has an empty line before it, we should keep
 	// the empty line before the next non-removed node to maintain the visual separation.
 	// Consider the following:
@@ -49,24 +49,26 @@ func removeDeleted(nodes []*ast.Node) []*ast.Node {
 	//
 	// If we decide to remove both foo2 and bar1, the result should still have one empty
 	// line between foo1 and bar2.
-	addEmptyLine := false
-	for _, node := range nodes {
+	addEmptyLine := map[*ast.Node]bool{} // By parent, nil for top-level nodes.
+	return ast.Walk(nodes, ast.VisitorFuncs{BeforeFunc: func(c *ast.Cursor) bool {
+		var parent *ast.Node
+		if path := c.Path(); len(path) > 0 {
+			parent = path[len(path)-1]
+		}
+		node := c.Node()
 		if node.Deleted {
 			if len(node.PreComments) > 0 && node.PreComments[0] == "" {
-				addEmptyLine = true
+				addEmptyLine[parent] = true
 			}
-			continue
-		}
-		if len(node.Children) > 0 {
-			node.Children = removeDeleted(node.Children)
+			c.Delete()
+			return false
 		}
-		if addEmptyLine && (len(node.PreComments) == 0 || node.PreComments[0] != "") {
+		if addEmptyLine[parent] && (len(node.PreComments) == 0 || node.PreComments[0] != "") {
 			node.PreComments = append([]string{""}, node.PreComments...)
 		}
-		addEmptyLine = false
-		res = append(res, node)
-	}
-	return res
+		addEmptyLine[parent] = false
+		return true
+	}})
 }
 
 // Debug returns a textual representation of the specified nodes for
@@ -100,8 +102,39 @@ func FormatNodes(nodes []*ast.Node) []byte {
 
 // FormatNodesWithDepth returns formatted nodes at the given indentation depth (0 = top-level) as bytes.
 func FormatNodesWithDepth(nodes []*ast.Node, depth int) []byte {
+	return FormatNodesWithConfig(nodes, depth, config.Config{})
+}
+
+// FormatNodesWithConfig functions similar to FormatNodesWithDepth, but indents as configured by
+// c.IndentWidth and c.UseTabs, lays out messages and lists as configured by c.MaxLineWidth and
+// aligns fields as configured by c.AlignValues and c.AlignComments. With c.Canonical, the nodes are
+// printed in the layout of that style instead, and c.RemoveComments removes their comments; both
+// work on a copy of the nodes.
+func FormatNodesWithConfig(nodes []*ast.Node, depth int, c config.Config) []byte {
+	nodes = removeDeleted(nodes)
+	if c.RemoveComments || c.Canonical != "" {
+		clones := make([]*ast.Node, len(nodes))
+		for i, nd := range nodes {
+			clones[i] = nd.Clone()
+		}
+		nodes = clones
+	}
+	if c.RemoveComments {
+		nodes = withoutComments(nodes)
+	}
 	var result bytes.Buffer
-	formatter{&result}.writeNodes(removeDeleted(nodes), depth, false /* isSameLine */, false /* asListItems */)
+	f := formatter{stringWriter: &result, indent: c.Indent(), indentColumns: c.IndentColumns()}
+	if c.Canonical != "" {
+		nodes = canonicalNodes(nodes, c.Canonical)
+		f.indent, f.indentColumns = "  ", 2
+	} else {
+		if !c.ExpandAllChildren {
+			f.maxLineWidth = c.MaxLineWidth
+		}
+		f.alignValues, f.alignComments = c.AlignValues, c.AlignComments
+		f.separators = c.Separators
+	}
+	f.writeNodes(nodes, depth, false /* isSameLine */, false /* asListItems */)
 	return result.Bytes()
 }
 
@@ -113,16 +146,37 @@ type stringWriter interface {
 // formatter accumulates pretty-printed textproto contents into a stringWriter.
 type formatter struct {
 	stringWriter
+	// indent is written for each level of indentation.
+	indent string
+	// indentColumns is the number of columns taken by indent.
+	indentColumns int
+	// maxLineWidth is the width within which messages and lists are written on one line, or zero to
+	// keep the layout of the input.
+	maxLineWidth int
+	// alignValues and alignComments align the values and inline comments of sibling fields.
+	alignValues, alignComments bool
+	// separators is the style of the separators between the fields of messages written on one line.
+	separators config.SeparatorStyle
+}
+
+// alignment is the padding of a field within a block of aligned siblings.
+type alignment struct {
+	// name is written after the name and colon, so that the value starts at the column of the values
+	// of the siblings.
+	name string
+	// comment is written before the inline comment at the end of the line instead of
+	// commentSpacing, so that it starts at the column of the comments of the siblings.
+	comment string
 }
 
-func (f formatter) writeNode(nd *ast.Node, depth int, isSameLine, asListItems bool, index, lastNonCommentIndex int) {
+func (f formatter) writeNode(nd *ast.Node, depth int, isSameLine, asListItems bool, index, lastNonCommentIndex int, align alignment) {
 	if len(nd.Raw) > 0 {
 		f.WriteString(nd.Raw)
 		return
 	}
 	indent := " "
 	if !isSameLine {
-		indent = strings.Repeat(indentSpaces, depth)
+		indent = strings.Repeat(f.indent, depth)
 	}
 	f.writePreComments(nd, indent, depth, index)
 
@@ -137,24 +191,100 @@ func (f formatter) writeNode(nd *ast.Node, depth int, isSameLine, asListItems bo
 	//   { name: "second_msg" }
 	// In all other cases, nd.Name is not empty and should be printed.
 	if nd.Name != "" {
-		f.writeNodeName(nd, indent)
+		f.writeNodeName(nd, indent, align.name)
 	}
 
-	f.writeNodeValues(nd, indent)
+	comma := asListItems && index < lastNonCommentIndex
+	sameLine := f.childrenSameLine(nd, depth, isSameLine, comma)
+
+	f.writeNodeValues(nd, indent, sameLine, align.commentSpacing())
 
-	f.writeNodeChildren(nd, depth, isSameLine)
+	f.writeNodeChildren(nd, depth, sameLine)
 
-	if asListItems && index < lastNonCommentIndex {
+	switch {
+	case comma:
 		f.WriteString(",")
+	case isSameLine && !asListItems:
+		f.writeSeparator(nd, index == lastNonCommentIndex)
 	}
 
-	f.writeNodeClosingBraceComment(nd)
+	f.writeNodeClosingBraceComment(nd, align.commentSpacing())
+}
+
+// childrenSameLine returns whether the children or list values of nd are written on the line of
+// its name. With a maxLineWidth, this is the case when they contain no comments and the whole node
+// fits within the width; otherwise the layout of the input is kept.
+func (f formatter) childrenSameLine(nd *ast.Node, depth int, isSameLine, comma bool) bool {
+	if isSameLine {
+		return true
+	}
+	if f.maxLineWidth <= 0 {
+		return nd.ChildrenSameLine
+	}
+	if (nd.Children == nil && !nd.ValuesAsList) || hasInnerComments(nd) {
+		return false
+	}
+	line := *nd
+	line.PreComments = nil
+	line.Separator = ""
+	var b strings.Builder
+	lf := f
+	lf.stringWriter = &b
+	lf.writeNode(&line, depth, true /* isSameLine */, false /* asListItems */, 0, 0, alignment{})
+	if strings.Contains(b.String(), "\n") {
+		return false
+	}
+	// The line starts with a space instead of the indentation.
+	width := depth*f.indentColumns + utf8.RuneCountInString(b.String()) - 1
+	if comma {
+		width++
+	}
+	return width <= f.maxLineWidth
+}
+
+// hasInnerComments returns whether there are comments within the brackets of nd, which prevent
+// writing it on one line.
+func hasInnerComments(nd *ast.Node) bool {
+	if len(nd.PostValuesComments) > 0 {
+		return true
+	}
+	for _, v := range nd.Values {
+		if len(v.PreComments) > 0 || v.InlineComment != "" {
+			return true
+		}
+	}
+	for _, c := range nd.Children {
+		if c.Deleted {
+			continue
+		}
+		if c.Raw != "" || len(c.PreComments) > 0 || c.ClosingBraceComment != "" || hasInnerComments(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeSeparator writes the separator after a field of a message written on one line.
+func (f formatter) writeSeparator(nd *ast.Node, isLast bool) {
+	switch f.separators {
+	case config.PreserveSeparators:
+		f.WriteString(nd.Separator)
+	case config.CommaSeparators:
+		if !isLast {
+			f.WriteString(",")
+		}
+	case config.SemicolonSeparators:
+		if !isLast {
+			f.WriteString(";")
+		}
+	}
 }
 
 func (f formatter) writePreComments(nd *ast.Node, indent string, depth int, index int) {
-	for _, comment := range nd.PreComments {
+	for i, comment := range nd.PreComments {
 		if len(comment) == 0 {
-			if !(depth == 0 && index == 0) {
+			// Don't start the file with a blank line.
+			if !(depth == 0 && index == 0 && i == 0) {
 				f.WriteString("\n")
 			}
 			continue
@@ -167,28 +297,152 @@ func (f formatter) writePreComments(nd *ast.Node, indent string, depth int, inde
 
 func (f formatter) writeNodes(nodes []*ast.Node, depth int, isSameLine, asListItems bool) {
 	lastNonCommentIndex := 0
-	if asListItems {
-		for i := len(nodes) - 1; i >= 0; i-- {
-			if !nodes[i].IsCommentOnly() {
-				lastNonCommentIndex = i
-				break
-			}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		if !nodes[i].IsCommentOnly() {
+			lastNonCommentIndex = i
+			break
 		}
 	}
 
+	var aligns []alignment
+	if !isSameLine && (f.alignValues || f.alignComments) {
+		aligns = f.alignBlocks(nodes, depth, asListItems, lastNonCommentIndex)
+	}
+
 	for index, nd := range nodes {
-		f.writeNode(nd, depth, isSameLine, asListItems, index, lastNonCommentIndex)
+		var align alignment
+		if aligns != nil {
+			align = aligns[index]
+		}
+		f.writeNode(nd, depth, isSameLine, asListItems, index, lastNonCommentIndex, align)
 		if !isSameLine && len(nd.Raw) == 0 && !nd.IsCommentOnly() {
 			f.WriteString("\n")
 		}
 	}
 }
 
-func (f formatter) writeNodeName(nd *ast.Node, indent string) {
+// commentSpacing returns the spacing written before the inline comment at the end of the line.
+func (a alignment) commentSpacing() string {
+	if a.comment == "" {
+		return commentSpacing
+	}
+	return a.comment
+}
+
+// alignBlocks returns the alignment of each of nodes, which are written on lines of their own.
+// Nodes are aligned within blocks of siblings, which are delimited by blank lines and comment-only
+// nodes.
+func (f formatter) alignBlocks(nodes []*ast.Node, depth int, asListItems bool, lastNonCommentIndex int) []alignment {
+	res := make([]alignment, len(nodes))
+	var block []int // Indices of the nodes in the current block.
+	endBlock := func() {
+		// Values are aligned first, as their padding is part of the width before the comments.
+		if f.alignValues {
+			alignBlockValues(nodes, block, res)
+		}
+		if f.alignComments {
+			f.alignBlockComments(nodes, block, res, depth, asListItems, lastNonCommentIndex)
+		}
+		block = nil
+	}
+	for i, nd := range nodes {
+		if nd.IsCommentOnly() || nd.Raw != "" {
+			endBlock()
+			continue
+		}
+		for _, c := range nd.PreComments {
+			if c == "" {
+				endBlock()
+				break
+			}
+		}
+		block = append(block, i)
+	}
+	endBlock()
+	return res
+}
+
+// alignBlockValues pads the names of the fields of a block, so that the values written after them
+// start at the same column.
+func alignBlockValues(nodes []*ast.Node, block []int, res []alignment) {
+	width := 0
+	for _, i := range block {
+		if w, ok := nameWidth(nodes[i]); ok && w > width {
+			width = w
+		}
+	}
+	for _, i := range block {
+		if w, ok := nameWidth(nodes[i]); ok {
+			res[i].name = strings.Repeat(" ", width-w)
+		}
+	}
+}
+
+// nameWidth returns the width of the name and colon of nd, and whether nd is a scalar field or
+// value list whose value is written after them on the same line.
+func nameWidth(nd *ast.Node) (int, bool) {
+	if nd.Name == "" || nd.Children != nil || nd.PutSingleValueOnNextLine {
+		return 0, false
+	}
+	if !nd.ValuesAsList && (len(nd.Values) != 1 || len(nd.Values[0].PreComments) > 0) {
+		return 0, false
+	}
+	w := utf8.RuneCountInString(nd.Name)
+	if !nd.SkipColon {
+		w++
+	}
+	return w, true
+}
+
+// alignBlockComments pads the inline comments of a block that are at the end of one-line fields, so
+// that they start at the same column.
+func (f formatter) alignBlockComments(nodes []*ast.Node, block []int, res []alignment, depth int, asListItems bool, lastNonCommentIndex int) {
+	widths := map[int]int{}
+	width := 0
+	for _, i := range block {
+		if w, ok := f.lineWidth(nodes[i], depth, asListItems, i, lastNonCommentIndex, res[i]); ok {
+			widths[i] = w
+			if w > width {
+				width = w
+			}
+		}
+	}
+	for i, w := range widths {
+		res[i].comment = commentSpacing + strings.Repeat(" ", width-w)
+	}
+}
+
+// lineWidth returns the width of nd as written with align, up to its inline comment, and whether nd
+// is written on one line that ends with an inline comment.
+func (f formatter) lineWidth(nd *ast.Node, depth int, asListItems bool, index, lastNonCommentIndex int, align alignment) (int, bool) {
+	comment := nd.ClosingBraceComment
+	if nd.Children == nil && !nd.ValuesAsList {
+		comment = ""
+		if len(nd.Values) > 0 {
+			comment = nd.Values[len(nd.Values)-1].InlineComment
+		}
+	}
+	if comment == "" {
+		return 0, false
+	}
+	line := *nd
+	line.PreComments = nil
+	var b strings.Builder
+	lf := f
+	lf.stringWriter = &b
+	lf.writeNode(&line, depth, false /* isSameLine */, asListItems, index, lastNonCommentIndex, alignment{name: align.name})
+	if strings.Contains(b.String(), "\n") {
+		return 0, false
+	}
+	return utf8.RuneCountInString(b.String()) - len(commentSpacing) - utf8.RuneCountInString(comment), true
+}
+
+func (f formatter) writeNodeName(nd *ast.Node, indent, padding string) {
 	f.WriteString(nd.Name)
 	if !nd.SkipColon {
 		f.WriteString(":")
 	}
+	f.WriteString(padding)
 
 	// The space after the name is required for one-liners and message fields:
 	//   title: "there was a space here"
@@ -196,39 +450,39 @@ func (f formatter) writeNodeName(nd *ast.Node, indent string) {
 	// In other cases, there is a newline right after the colon, so no space required.
 	if nd.Children != nil || (len(nd.Values) == 1 && len(nd.Values[0].PreComments) == 0) || nd.ValuesAsList {
 		if nd.PutSingleValueOnNextLine {
-			f.WriteString("\n" + indent + indentSpaces)
+			f.WriteString("\n" + indent + f.indent)
 		} else {
 			f.WriteString(" ")
 		}
 	}
 }
 
-func (f formatter) writeNodeValues(nd *ast.Node, indent string) {
+func (f formatter) writeNodeValues(nd *ast.Node, indent string, sameLine bool, spacing string) {
 	if nd.ValuesAsList { // For ValuesAsList option we will preserve even empty list  `field: []`
-		f.writeValuesAsList(nd, nd.Values, indent+indentSpaces)
+		f.writeValuesAsList(nd, nd.Values, indent+f.indent, sameLine)
 	} else if len(nd.Values) > 0 {
-		f.writeValues(nd, nd.Values, indent+indentSpaces)
+		f.writeValues(nd, nd.Values, indent+f.indent, spacing)
 	}
 }
 
-func (f formatter) writeNodeChildren(nd *ast.Node, depth int, isSameLine bool) {
+func (f formatter) writeNodeChildren(nd *ast.Node, depth int, sameLine bool) {
 	if nd.Children != nil { // Also for 0 Children.
 		if nd.ChildrenAsList {
-			f.writeChildrenAsListItems(nd.Children, depth+1, isSameLine || nd.ChildrenSameLine)
+			f.writeChildrenAsListItems(nd.Children, depth+1, sameLine)
 		} else {
-			f.writeChildren(nd.Children, depth+1, isSameLine || nd.ChildrenSameLine, nd.IsAngleBracket)
+			f.writeChildren(nd.Children, depth+1, sameLine, nd.IsAngleBracket)
 		}
 	}
 }
 
-func (f formatter) writeNodeClosingBraceComment(nd *ast.Node) {
+func (f formatter) writeNodeClosingBraceComment(nd *ast.Node, spacing string) {
 	if (nd.Children != nil || nd.ValuesAsList) && len(nd.ClosingBraceComment) > 0 {
-		f.WriteString(indentSpaces)
+		f.WriteString(spacing)
 		f.WriteString(nd.ClosingBraceComment)
 	}
 }
 
-func (f formatter) writeValues(nd *ast.Node, vals []*ast.Value, indent string) {
+func (f formatter) writeValues(nd *ast.Node, vals []*ast.Value, indent, spacing string) {
 	if len(vals) == 0 {
 		// This should never happen: formatValues can be called only if there are some values.
 		return
@@ -245,7 +499,7 @@ func (f formatter) writeValues(nd *ast.Node, vals []*ast.Value, indent string) {
 		}
 		f.WriteString(v.Value)
 		if len(v.InlineComment) > 0 {
-			f.WriteString(indentSpaces)
+			f.WriteString(spacing)
 			f.WriteString(v.InlineComment)
 		}
 	}
@@ -255,8 +509,8 @@ func (f formatter) writeValues(nd *ast.Node, vals []*ast.Value, indent string) {
 	}
 }
 
-func (f formatter) canWriteValuesAsListOnSameLine(nd *ast.Node, vals []*ast.Value) bool {
-	if !nd.ChildrenSameLine || len(nd.PostValuesComments) > 0 {
+func (f formatter) canWriteValuesAsListOnSameLine(nd *ast.Node, vals []*ast.Value, sameLine bool) bool {
+	if !sameLine || len(nd.PostValuesComments) > 0 {
 		return false
 	}
 	// Parser found all children on a same line, but we need to check again.
@@ -269,9 +523,9 @@ func (f formatter) canWriteValuesAsListOnSameLine(nd *ast.Node, vals []*ast.Valu
 	return true
 }
 
-func (f formatter) writeValuesAsList(nd *ast.Node, vals []*ast.Value, indent string) {
+func (f formatter) writeValuesAsList(nd *ast.Node, vals []*ast.Value, indent string, sameLine bool) {
 	// Checks if it's possible to put whole list in a single line.
-	sameLine := f.canWriteValuesAsListOnSameLine(nd, vals)
+	sameLine = f.canWriteValuesAsListOnSameLine(nd, vals, sameLine)
 	sep := ""
 	if !sameLine {
 		sep = "\n" + indent
@@ -292,7 +546,7 @@ func (f formatter) writeValuesAsList(nd *ast.Node, vals []*ast.Value, indent str
 			}
 		}
 		if len(v.InlineComment) > 0 {
-			f.WriteString(indentSpaces)
+			f.WriteString(commentSpacing)
 			f.WriteString(v.InlineComment)
 		}
 	}
@@ -300,7 +554,7 @@ func (f formatter) writeValuesAsList(nd *ast.Node, vals []*ast.Value, indent str
 		f.WriteString(sep)
 		f.WriteString(comment)
 	}
-	f.WriteString(strings.Replace(sep, indentSpaces, "", 1))
+	f.WriteString(strings.TrimSuffix(sep, f.indent))
 	f.WriteString("]")
 }
 
@@ -322,7 +576,7 @@ func (f formatter) writeChildren(children []*ast.Node, depth int, sameLine, isAn
 	default:
 		f.WriteString(openBrace + "\n")
 		f.writeNodes(children, depth, sameLine, false /* asListItems */)
-		f.WriteString(strings.Repeat(indentSpaces, depth-1))
+		f.WriteString(strings.Repeat(f.indent, depth-1))
 		f.WriteString(closeBrace)
 	}
 }
@@ -341,7 +595,7 @@ func (f formatter) writeChildrenAsListItems(children []*ast.Node, depth int, sam
 	default:
 		f.WriteString(openBrace + "\n")
 		f.writeNodes(children, depth, sameLine, true /* asListItems */)
-		f.WriteString(strings.Repeat(indentSpaces, depth-1))
+		f.WriteString(strings.Repeat(f.indent, depth-1))
 		f.WriteString(closeBrace)
 	}
 }
@@ -0,0 +1,170 @@
+package printer
+
+import (
+	"bytes"
+
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/config"
+	"github.com/protocolbuffers/txtpbfmt/impl"
+	"github.com/protocolbuffers/txtpbfmt/sort"
+)
+
+// FormatRange functions similar to FormatWithConfig, but only formats the nodes overlapping the
+// lines from startLine to endLine (1-based, inclusive) and leaves the rest of the input untouched.
+//
+// A node is formatted as a whole, including its comments, unless it is a multi-line message that
+// isn't contained in the range; then the lines up to its opening bracket, its children and the line
+// of its closing bracket are formatted separately, where they overlap the range. Nodes
+// sharing lines, the children of single-line messages and lists of messages are formatted together.
+// Sorting only applies within the formatted nodes.
+func FormatRange(in []byte, startLine, endLine int, c config.Config) ([]byte, error) {
+	if err := impl.AddMetaCommentsToConfig(in, &c); err != nil {
+		return nil, err
+	}
+	if c.Disable {
+		c.Infof("Ignored file with 'disable' comment.")
+		return in, nil
+	}
+	nodes, err := impl.ParseUnsorted(in, c)
+	if err != nil {
+		return nil, err
+	}
+	r := &rangeFormatter{in: in, startLine: startLine, endLine: endLine, config: c, lineStarts: []int{0}}
+	for i, b := range in {
+		if b == '\n' {
+			r.lineStarts = append(r.lineStarts, i+1)
+		}
+	}
+	lastLine := len(r.lineStarts)
+	if bytes.HasSuffix(in, []byte("\n")) {
+		lastLine--
+	}
+	if err := r.formatNodes(nil, nodes, 0, lastLine); err != nil {
+		return nil, err
+	}
+	var res bytes.Buffer
+	offset := 0
+	for _, e := range r.edits {
+		res.Write(in[offset:e.start])
+		res.Write(e.text)
+		offset = e.end
+	}
+	res.Write(in[offset:])
+	return res.Bytes(), nil
+}
+
+type rangeFormatter struct {
+	in                 []byte
+	startLine, endLine int
+	config             config.Config
+	// lineStarts holds the byte offset of the start of each line.
+	lineStarts []int
+	// edits replace the formatted nodes, in input order.
+	edits []rangeEdit
+}
+
+type rangeEdit struct {
+	start, end int
+	text       []byte
+}
+
+// formatNodes formats the nodes overlapping the range, where nodes are the children of parent
+// at the given depth, spanning the input up to lastLine.
+func (r *rangeFormatter) formatNodes(parent *ast.Node, nodes []*ast.Node, depth int, lastLine int) error {
+	for i := 0; i < len(nodes); {
+		// Nodes start on a new line unless they share it with the previous node.
+		j := i + 1
+		for j < len(nodes) && nodes[j].Start.Column != 1 {
+			j++
+		}
+		first := int(nodes[i].Start.Line)
+		last := lastLine
+		if j < len(nodes) {
+			last = int(nodes[j].Start.Line) - 1
+		}
+		group := nodes[i:j]
+		start := i
+		i = j
+		if last < r.startLine || first > r.endLine {
+			continue
+		}
+		if nd := group[0]; len(group) == 1 && (first < r.startLine || last > r.endLine) && r.isMultiLineMessage(nd) {
+			if err := r.formatMessage(nd, depth, start > 0, first, last); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := sort.Process(parent, group, r.config); err != nil {
+			return err
+		}
+		text := r.emptyLineBefore(group[0], depth, start > 0)
+		text = append(text, FormatNodesWithConfig(group, depth, r.config)...)
+		r.edits = append(r.edits, rangeEdit{start: r.lineStart(first), end: r.lineStart(last + 1), text: text})
+	}
+	return nil
+}
+
+// formatMessage formats the lines of the multi-line message nd, spanning the lines from first to
+// last, that overlap the range: the lines up to its opening bracket, its children and the line of
+// its closing bracket are formatted separately.
+func (r *rangeFormatter) formatMessage(nd *ast.Node, depth int, hasPrevious bool, first, last int) error {
+	headerLast := int(nd.End.Line) - 1
+	if len(nd.Children) > 0 {
+		headerLast = int(nd.Children[0].Start.Line) - 1
+	}
+	// Format the message with a single child in place of its children, which separates the lines of
+	// the brackets in every layout.
+	c := r.config
+	c.MaxLineWidth = 0
+	msg := *nd
+	msg.ChildrenSameLine = false
+	msg.Children = []*ast.Node{{Name: "_", Values: []*ast.Value{{Value: "0"}}}}
+	lines := bytes.SplitAfter(FormatNodesWithConfig([]*ast.Node{&msg}, depth, c), []byte("\n"))
+	// The output ends with a newline, so the last element is empty.
+	if len(lines) < 4 {
+		return r.formatNodes(nd, nd.Children, depth+1, int(nd.End.Line)-1)
+	}
+	if first <= r.endLine && headerLast >= r.startLine {
+		text := r.emptyLineBefore(nd, depth, hasPrevious)
+		text = append(text, bytes.Join(lines[:len(lines)-3], nil)...)
+		r.edits = append(r.edits, rangeEdit{start: r.lineStart(first), end: r.lineStart(headerLast + 1), text: text})
+	}
+	if err := r.formatNodes(nd, nd.Children, depth+1, int(nd.End.Line)-1); err != nil {
+		return err
+	}
+	if int(nd.End.Line) <= r.endLine && last >= r.startLine {
+		r.edits = append(r.edits, rangeEdit{start: r.lineStart(int(nd.End.Line)), end: r.lineStart(last + 1), text: lines[len(lines)-2]})
+	}
+	return nil
+}
+
+// emptyLineBefore returns the empty line to write before the formatted node nd, if any. Unlike for
+// the first node of the file, the empty line before the first formatted node is kept.
+func (r *rangeFormatter) emptyLineBefore(nd *ast.Node, depth int, hasPrevious bool) []byte {
+	if depth == 0 && hasPrevious && len(nd.PreComments) > 0 && nd.PreComments[0] == "" {
+		return []byte("\n")
+	}
+	return nil
+}
+
+// lineStart returns the byte offset of the start of the given line (1-based), or the length of the
+// input for lines after its end.
+func (r *rangeFormatter) lineStart(line int) int {
+	if line > len(r.lineStarts) {
+		return len(r.in)
+	}
+	return r.lineStarts[line-1]
+}
+
+// isMultiLineMessage reports whether the children of nd can be formatted separately, i.e. whether
+// they are on lines of their own between the opening and closing brackets.
+func (r *rangeFormatter) isMultiLineMessage(nd *ast.Node) bool {
+	if nd.Children == nil || nd.ChildrenSameLine || nd.ChildrenAsList || nd.Raw != "" || nd.End.Line <= nd.Start.Line {
+		return false
+	}
+	if len(nd.Children) > 0 && nd.Children[0].Start.Column != 1 {
+		return false
+	}
+	closing := bytes.TrimLeft(r.in[r.lineStart(int(nd.End.Line)):], " \t")
+	return len(closing) > 0 && (closing[0] == '}' || closing[0] == '>')
+}
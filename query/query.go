@@ -0,0 +1,405 @@
+// Package query provides a path query language to look up nodes in the parse tree.
+//
+// A query is a list of steps separated by dots, each matching fields by name, e.g.
+//
+//	job[name="foo"].task[0].resources.cpu
+//
+// A step is one of:
+//
+//	name        fields with the given name
+//	[com.ext]   extension fields with the given name
+//	*           all fields, including unnamed messages
+//	**          the current fields and all of their descendants; must be followed by another step
+//
+// Each step but ** may be followed by selectors, which are applied in order:
+//
+//	[2]         the field at the given index among the matches within the same parent; negative
+//	            indices count from the end
+//	[path]      fields that have a descendant at the given relative path, e.g. [spec.name]
+//	[path=lit]  fields that have a descendant at path with the given value
+//	[path!=lit] fields that don't have a descendant at path with the given value
+//
+// A literal is either a quoted string, which is compared to the unquoted value, or any other token
+// such as a number or an enum value, which is compared to the value as written. Each value of a
+// list is compared separately.
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/unquote"
+)
+
+// Query is a compiled path query. It is safe for concurrent use.
+type Query struct {
+	src   string
+	steps []step
+}
+
+type step struct {
+	// name is the field name to match, including the brackets of extension names. It is empty for
+	// steps matching all fields.
+	name string
+	// descendants is set for "**" steps.
+	descendants bool
+	selectors   []selector
+	// end is the offset of the end of the step in the source.
+	end int
+}
+
+type selector struct {
+	// isIndex is set for index selectors.
+	isIndex bool
+	index   int
+	// path is the relative path of predicates.
+	path *Query
+	// op is "=", "!=" or empty for existence predicates.
+	op string
+	// literal is the unquoted value of quoted literals, or the value as written otherwise.
+	literal string
+	quoted  bool
+}
+
+// Compile parses a query.
+func Compile(src string) (*Query, error) {
+	p := &queryParser{src: src}
+	q, err := p.parsePath(false /* relative */)
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(src) {
+		return nil, p.errorf("unexpected %q", src[p.i])
+	}
+	return q, nil
+}
+
+// MustCompile is like Compile but panics if the query can't be parsed. It simplifies the
+// initialization of global variables holding queries.
+func MustCompile(src string) *Query {
+	q, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// String returns the source of the query.
+func (q *Query) String() string {
+	return q.src
+}
+
+// Len returns the number of steps of the query.
+func (q *Query) Len() int {
+	return len(q.steps)
+}
+
+// Prefix returns the query made of the first n steps of the query.
+func (q *Query) Prefix(n int) *Query {
+	if n == 0 {
+		return &Query{}
+	}
+	return &Query{src: q.src[:q.steps[n-1].end], steps: q.steps[:n]}
+}
+
+// FieldName returns the name of the fields matched by the step at index i, and whether the step
+// only matches fields by that name, i.e. it isn't a wildcard and has no selectors.
+func (q *Query) FieldName(i int) (string, bool) {
+	s := q.steps[i]
+	return s.name, s.name != "" && len(s.selectors) == 0
+}
+
+// Nodes returns the nodes matched by the query among nodes and their descendants, in the order in
+// which they appear in the tree, without duplicates.
+func (q *Query) Nodes(nodes []*ast.Node) []*ast.Node {
+	containers := [][]*ast.Node{nodes}
+	var matched []*ast.Node
+	for _, s := range q.steps {
+		if s.descendants {
+			var all [][]*ast.Node
+			for _, c := range containers {
+				all = appendDescendants(all, c)
+			}
+			containers = all
+			continue
+		}
+		matched = nil
+		seen := map[*ast.Node]bool{}
+		for _, c := range containers {
+			for _, nd := range s.match(c) {
+				if !seen[nd] {
+					seen[nd] = true
+					matched = append(matched, nd)
+				}
+			}
+		}
+		containers = nil
+		for _, nd := range matched {
+			if len(nd.Children) > 0 {
+				containers = append(containers, nd.Children)
+			}
+		}
+	}
+	return matched
+}
+
+// Values returns the values of the nodes matched by the query.
+func (q *Query) Values(nodes []*ast.Node) []*ast.Value {
+	var res []*ast.Value
+	for _, nd := range q.Nodes(nodes) {
+		res = append(res, nd.Values...)
+	}
+	return res
+}
+
+// appendDescendants appends nodes and the children of all of their descendants.
+func appendDescendants(res [][]*ast.Node, nodes []*ast.Node) [][]*ast.Node {
+	res = append(res, nodes)
+	for _, nd := range nodes {
+		if len(nd.Children) > 0 && !nd.Deleted {
+			res = appendDescendants(res, nd.Children)
+		}
+	}
+	return res
+}
+
+// match returns the nodes among the children of a single parent matched by the step.
+func (s step) match(nodes []*ast.Node) []*ast.Node {
+	var res []*ast.Node
+	for _, nd := range nodes {
+		if nd.Deleted || nd.IsCommentOnly() {
+			continue
+		}
+		if s.name == "" || nd.Name == s.name {
+			res = append(res, nd)
+		}
+	}
+	for _, sel := range s.selectors {
+		res = sel.apply(res)
+	}
+	return res
+}
+
+func (sel selector) apply(nodes []*ast.Node) []*ast.Node {
+	if sel.isIndex {
+		i := sel.index
+		if i < 0 {
+			i += len(nodes)
+		}
+		if i < 0 || i >= len(nodes) {
+			return nil
+		}
+		return nodes[i : i+1]
+	}
+	var res []*ast.Node
+	for _, nd := range nodes {
+		found := false
+		for _, m := range sel.path.Nodes(nd.Children) {
+			if sel.op == "" || sel.matchesValue(m) {
+				found = true
+				break
+			}
+		}
+		if found != (sel.op == "!=") {
+			res = append(res, nd)
+		}
+	}
+	return res
+}
+
+// matchesValue reports whether the value of nd equals the literal.
+func (sel selector) matchesValue(nd *ast.Node) bool {
+	if len(nd.Values) == 0 {
+		return false
+	}
+	values := [][]*ast.Value{nd.Values}
+	if nd.ValuesAsList {
+		values = nil
+		for _, v := range nd.Values {
+			values = append(values, []*ast.Value{v})
+		}
+	}
+	for _, vs := range values {
+		if !sel.quoted {
+			if len(vs) == 1 && vs[0].Value == sel.literal {
+				return true
+			}
+			continue
+		}
+		s, _, err := unquote.Unquote(&ast.Node{Values: vs})
+		if err == nil && s == sel.literal {
+			return true
+		}
+	}
+	return false
+}
+
+type queryParser struct {
+	src string
+	i   int
+}
+
+func (p *queryParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid query %q at offset %d: %s", p.src, p.i, fmt.Sprintf(format, args...))
+}
+
+func (p *queryParser) peek() byte {
+	if p.i < len(p.src) {
+		return p.src[p.i]
+	}
+	return 0
+}
+
+func (p *queryParser) skipSpaces() {
+	for p.peek() == ' ' || p.peek() == '\t' {
+		p.i++
+	}
+}
+
+// parsePath parses steps separated by dots. Relative paths, used in predicates, only consist of
+// names and extension names.
+func (p *queryParser) parsePath(relative bool) (*Query, error) {
+	start := p.i
+	q := &Query{}
+	for {
+		s, err := p.parseStep(relative)
+		if err != nil {
+			return nil, err
+		}
+		s.end = p.i - start
+		q.steps = append(q.steps, s)
+		if p.peek() != '.' {
+			break
+		}
+		p.i++
+	}
+	if q.steps[len(q.steps)-1].descendants {
+		return nil, p.errorf("** must be followed by another step")
+	}
+	q.src = p.src[start:p.i]
+	return q, nil
+}
+
+func (p *queryParser) parseStep(relative bool) (step, error) {
+	var s step
+	switch c := p.peek(); {
+	case c == '*' && !relative:
+		p.i++
+		if p.peek() == '*' {
+			p.i++
+			return step{descendants: true}, nil
+		}
+	case c == '[':
+		end := strings.IndexByte(p.src[p.i:], ']')
+		if end < 0 {
+			return s, p.errorf("missing ']'")
+		}
+		name := strings.Join(strings.Fields(p.src[p.i+1:p.i+end]), "")
+		if name == "" {
+			return s, p.errorf("empty extension name")
+		}
+		s.name = "[" + name + "]"
+		p.i += end + 1
+	case isNameChar(c):
+		start := p.i
+		for isNameChar(p.peek()) {
+			p.i++
+		}
+		s.name = p.src[start:p.i]
+	case c == 0:
+		return s, p.errorf("missing field name")
+	default:
+		return s, p.errorf("unexpected %q", c)
+	}
+	for !relative && p.peek() == '[' {
+		sel, err := p.parseSelector()
+		if err != nil {
+			return s, err
+		}
+		s.selectors = append(s.selectors, sel)
+	}
+	return s, nil
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func (p *queryParser) parseSelector() (selector, error) {
+	var sel selector
+	p.i++ // '['
+	p.skipSpaces()
+	if c := p.peek(); c == '-' || ('0' <= c && c <= '9') {
+		start := p.i
+		p.i++
+		for '0' <= p.peek() && p.peek() <= '9' {
+			p.i++
+		}
+		index, err := strconv.Atoi(p.src[start:p.i])
+		if err != nil {
+			return sel, p.errorf("invalid index %q", p.src[start:p.i])
+		}
+		sel.isIndex = true
+		sel.index = index
+	} else {
+		path, err := p.parsePath(true /* relative */)
+		if err != nil {
+			return sel, err
+		}
+		sel.path = path
+		p.skipSpaces()
+		switch {
+		case strings.HasPrefix(p.src[p.i:], "!="):
+			sel.op = "!="
+		case p.peek() == '=':
+			sel.op = "="
+		}
+		if sel.op != "" {
+			p.i += len(sel.op)
+			p.skipSpaces()
+			if err := p.parseLiteral(&sel); err != nil {
+				return sel, err
+			}
+		}
+	}
+	p.skipSpaces()
+	if p.peek() != ']' {
+		return sel, p.errorf("missing ']'")
+	}
+	p.i++
+	return sel, nil
+}
+
+func (p *queryParser) parseLiteral(sel *selector) error {
+	if q := p.peek(); q == '"' || q == '\'' {
+		// Find the closing quote, skipping escaped characters.
+		end := p.i + 1
+		for ; end < len(p.src) && p.src[end] != q; end++ {
+			if p.src[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(p.src) {
+			return p.errorf("unterminated string")
+		}
+		s, _, err := unquote.Unquote(&ast.Node{Values: []*ast.Value{{Value: p.src[p.i : end+1]}}})
+		if err != nil {
+			return p.errorf("invalid string: %v", err)
+		}
+		sel.literal = s
+		sel.quoted = true
+		p.i = end + 1
+		return nil
+	}
+	start := p.i
+	for p.i < len(p.src) && p.src[p.i] != ']' && p.src[p.i] != ' ' {
+		p.i++
+	}
+	if p.i == start {
+		return p.errorf("missing value")
+	}
+	sel.literal = p.src[start:p.i]
+	return nil
+}
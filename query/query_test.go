@@ -0,0 +1,185 @@
+package query_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kylelemons/godebug/diff"
+	"github.com/protocolbuffers/txtpbfmt/ast"
+	"github.com/protocolbuffers/txtpbfmt/parser"
+	"github.com/protocolbuffers/txtpbfmt/query"
+)
+
+const content = `# Comment.
+job {
+  name: "foo"
+  task {
+    id: 1
+    resources { cpu: 2 }
+  }
+  task {
+    id: 2
+    resources { cpu: 4 }
+  }
+  [com.foo.ext] { priority: HIGH }
+}
+job {
+  name: 'bar'
+  tags: ["a", "b"]
+  task {
+    id: 3
+  }
+}
+`
+
+func TestNodes(t *testing.T) {
+	inputs := []struct {
+		query string
+		want  string
+	}{{
+		query: `job.name`,
+		want: `name: "foo"
+name: "bar"
+`,
+	}, {
+		query: `job[name="foo"].task[0].resources.cpu`,
+		want: `cpu: 2
+`,
+	}, {
+		query: `job[name='bar'].task.id`,
+		want: `id: 3
+`,
+	}, {
+		query: `job.task[-1].id`,
+		want: `id: 2
+id: 3
+`,
+	}, {
+		query: `job[1].task[id=3]`,
+		want: `task {
+  id: 3
+}
+`,
+	}, {
+		query: `job[tags="b"].name`,
+		want: `name: "bar"
+`,
+	}, {
+		query: `job[name!="foo"].name`,
+		want: `name: "bar"
+`,
+	}, {
+		query: `job.task[resources].id`,
+		want: `id: 1
+id: 2
+`,
+	}, {
+		query: `job.task[resources.cpu=4].id`,
+		want: `id: 2
+`,
+	}, {
+		query: `**.id`,
+		want: `id: 1
+id: 2
+id: 3
+`,
+	}, {
+		query: `**.**.cpu`,
+		want: `cpu: 2
+cpu: 4
+`,
+	}, {
+		query: `job.*[id].id`,
+		want: `id: 1
+id: 2
+id: 3
+`,
+	}, {
+		query: `job.[com.foo.ext].priority`,
+		want: `priority: HIGH
+`,
+	}, {
+		query: `job[[ com.foo.ext ].priority=HIGH].name`,
+		want: `name: "foo"
+`,
+	}, {
+		query: `job.task[5]`,
+		want:  ``,
+	}, {
+		query: `missing.name`,
+		want:  ``,
+	}}
+	nodes, err := parser.Parse([]byte(content))
+	if err != nil {
+		t.Fatalf("Parse returned err %v", err)
+	}
+	for _, input := range inputs {
+		q, err := query.Compile(input.query)
+		if err != nil {
+			t.Errorf("Compile(%q) returned err %v", input.query, err)
+			continue
+		}
+		got := parser.Pretty(q.Nodes(nodes), 0)
+		if diff := diff.Diff(input.want, got); diff != "" {
+			t.Errorf("Nodes(%q) returned diff (-want, +got):\n%s", input.query, diff)
+		}
+	}
+}
+
+func TestValues(t *testing.T) {
+	nodes, err := parser.Parse([]byte(content))
+	if err != nil {
+		t.Fatalf("Parse returned err %v", err)
+	}
+	var got []string
+	for _, v := range query.MustCompile("job.tags").Values(nodes) {
+		got = append(got, v.Value)
+	}
+	if diff := cmp.Diff([]string{`"a"`, `"b"`}, got); diff != "" {
+		t.Errorf("Values returned diff (-want, +got):\n%s", diff)
+	}
+	if got := query.MustCompile("job.name").Values([]*ast.Node{}); got != nil {
+		t.Errorf("Values on empty nodes returned %v, want nil", got)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	inputs := []struct {
+		query string
+		err   string
+	}{{
+		query: ``,
+		err:   "missing field name",
+	}, {
+		query: `job.`,
+		err:   "missing field name",
+	}, {
+		query: `job.**`,
+		err:   "must be followed",
+	}, {
+		query: `job[name="foo"`,
+		err:   "missing ']'",
+	}, {
+		query: `job[name="foo]`,
+		err:   "unterminated string",
+	}, {
+		query: `job[name=]`,
+		err:   "missing value",
+	}, {
+		query: `[com.ext`,
+		err:   "missing ']'",
+	}, {
+		query: `job name`,
+		err:   "unexpected ' '",
+	}, {
+		query: `job[*]`,
+		err:   "unexpected '*'",
+	}}
+	for _, input := range inputs {
+		_, err := query.Compile(input.query)
+		if err == nil || !strings.Contains(err.Error(), input.err) {
+			t.Errorf("Compile(%q) returned err %v, want error containing %q", input.query, err, input.err)
+		}
+	}
+}
@@ -34,6 +34,11 @@ func TestUnquote(t *testing.T) {
 		want:     `foo"bar`,
 		wantRaw:  `foo\"bar`,
 		wantRune: rune('\''),
+	}, {
+		in:       `"caf\u00e9 \U0001F600 \x41\101"`,
+		want:     "caf\u00e9 \U0001F600 AA",
+		wantRaw:  `caf\u00e9 \U0001F600 \x41\101`,
+		wantRune: rune('"'),
 	}}
 	for _, input := range inputs {
 		node := &ast.Node{Name: "name", Values: []*ast.Value{{Value: input.in}}}
@@ -14,7 +14,8 @@ import (
 
 var tagRegex = regexp.MustCompile(`<.*>`)
 
-const indentSpaces = "  "
+// commentSpacing separates inline comments from the values before them, as printed.
+const commentSpacing = "  "
 
 // Strings wraps the strings in the given nodes.
 func Strings(nodes []*ast.Node, depth int, c config.Config) error {
@@ -73,10 +74,9 @@ func shouldNotWrapString(nd *ast.Node, c config.Config) bool {
 }
 
 func needsWrappingAtColumn(nd *ast.Node, depth int, c config.Config) bool {
-	// Even at depth 0 we have a 2-space indent when the wrapped string is rendered on the line below
-	// the field name.
-	const lengthBuffer = 2
-	maxLength := c.WrapStringsAtColumn - lengthBuffer - (depth * len(indentSpaces))
+	// Even at depth 0 we have one level of indentation when the wrapped string is rendered on the
+	// line below the field name.
+	maxLength := c.WrapStringsAtColumn - (depth+1)*c.IndentColumns()
 
 	if shouldNotWrapString(nd, c) {
 		return false
@@ -117,7 +117,7 @@ func wrapLinesWithoutWordwrap(str string, maxLength int) []string {
 func adjustLineLength(nd *ast.Node, v *ast.Value, line string, maxLength int, i int, numLines int) {
 	lineLength := len(line)
 	if v.InlineComment != "" {
-		lineLength += len(indentSpaces) + len(v.InlineComment)
+		lineLength += len(commentSpacing) + len(v.InlineComment)
 	}
 	// field name and field value are inlined for single strings, adjust for that.
 	if i == 0 && numLines == 1 {
@@ -143,8 +143,9 @@ func wrapLinesAtColumn(nd *ast.Node, depth int, c config.Config) error {
 	// This function looks at the unquoted ast.Value.Value string (i.e., with each Value's wrapping
 	// quote chars removed). We need to remove these quotes, since otherwise they'll be re-flowed into
 	// the body of the text.
-	const lengthBuffer = 4 // Even at depth 0 we have a 2-space indent and a pair of quotes
-	maxLength := c.WrapStringsAtColumn - lengthBuffer - (depth * len(indentSpaces))
+	// Even at depth 0 we have one level of indentation and a pair of quotes.
+	const quotes = 2
+	maxLength := c.WrapStringsAtColumn - quotes - (depth+1)*c.IndentColumns()
 
 	str, quote, err := unquote.Raw(nd)
 	if err != nil {